@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// logLevel is the minimum level of the default slog logger.
+	logLevel = new(slog.LevelVar)
+
+	// traceLogEnabled turns on a log line per request with its trace ID,
+	// route, status and latency.
+	traceLogEnabled atomic.Bool
+)
+
+// initLogging installs the default logger with the level from LOG_LEVEL.
+func initLogging() {
+	if err := logLevel.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		logLevel.Set(slog.LevelInfo)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})).With("instance", instanceID)
+	if region != "" {
+		logger = logger.With("region", region)
+	}
+	slog.SetDefault(logger)
+	traceLogEnabled.Store(getEnv("TRACE_LOG", "false") == "true")
+}
+
+// traceLogMiddleware logs every request while traceLogEnabled is set.
+func traceLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := clk.Now()
+		c.Next()
+		if !traceLogEnabled.Load() || c.GetBool(untracedKey) {
+			return
+		}
+		slog.Info("request",
+			"trace_id", traceIDFromContext(c.Request.Context()),
+			"request_id", requestIDFromContext(c.Request.Context()),
+			"session", hasSessionCookie(c),
+			"api_key", c.GetString(apiKeyNameKey),
+			"tenant", tenantFromContext(c.Request.Context()),
+			"client_cert", clientCertFromContext(c.Request.Context()),
+			"method", c.Request.Method,
+			"proto", c.Request.Proto,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"deadline_exceeded", c.GetBool(deadlineExceededKey),
+			"idempotent_replay", c.GetBool(idempotentReplayKey),
+			"etag_match", c.GetBool(etagMatchKey),
+			"duration", clk.Since(start),
+		)
+	}
+}
+
+// adminAuth only lets through requests bearing ADMIN_TOKEN. Admin endpoints
+// are disabled when no token is configured.
+func adminAuth() gin.HandlerFunc {
+	token := getEnv("ADMIN_TOKEN", "")
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled, set ADMIN_TOKEN"})
+			return
+		}
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func getLogLevelFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": logLevel.Level().String()})
+}
+
+// setLogLevelFunc changes the log level, e.g. {"level": "debug"}.
+func setLogLevelFunc(c *gin.Context) {
+	var req struct {
+		Level string `json:"level" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := logLevel.UnmarshalText([]byte(req.Level)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordEvent(c.Request.Context(), "config", "log level set to %s", logLevel.Level())
+	getLogLevelFunc(c)
+}
+
+func getTracerFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"trace_log": traceLogEnabled.Load(), "body_capture": bodyCaptureEnabled.Load()})
+}
+
+// setTracerFunc toggles request trace logging and body capture, e.g.
+// {"trace_log": true} or {"body_capture": false}.
+func setTracerFunc(c *gin.Context) {
+	var req struct {
+		TraceLog    *bool `json:"trace_log"`
+		BodyCapture *bool `json:"body_capture"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.TraceLog == nil && req.BodyCapture == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "set trace_log or body_capture"})
+		return
+	}
+	if req.TraceLog != nil {
+		traceLogEnabled.Store(*req.TraceLog)
+		recordEvent(c.Request.Context(), "config", "trace log enabled: %t", *req.TraceLog)
+	}
+	if req.BodyCapture != nil {
+		bodyCaptureEnabled.Store(*req.BodyCapture)
+		recordEvent(c.Request.Context(), "config", "body capture enabled: %t", *req.BodyCapture)
+	}
+	getTracerFunc(c)
+}
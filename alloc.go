@@ -0,0 +1,92 @@
+package main
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAllocMB     = 1024
+	allocChunkSize = 64 * 1024
+)
+
+// maxRetainedMB bounds the memory /alloc/:mb?retain=true may hold on to.
+var maxRetainedMB = getEnvInt("ALLOC_MAX_RETAINED_MB", 512)
+
+// retained is the memory kept by /alloc/:mb?retain=true until DELETE /alloc.
+var retained struct {
+	sync.Mutex
+	chunks [][]byte
+}
+
+func init() {
+	expvar.Publish("alloc_retained_bytes", expvar.Func(func() any { return retainedBytes() }))
+}
+
+func retainedBytes() int {
+	retained.Lock()
+	defer retained.Unlock()
+	return len(retained.chunks) * allocChunkSize
+}
+
+// allocFunc allocates :mb megabytes in 64 KiB chunks, touching every page
+// so the memory is really used. The garbage is left to the GC unless
+// ?retain=true, in which case it's kept, growing the live heap, until
+// DELETE /admin/alloc.
+func allocFunc(c *gin.Context) {
+	mb, err := strconv.Atoi(c.Param("mb"))
+	if err != nil || mb < 1 || mb > maxAllocMB {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mb must be between 1 and " + strconv.Itoa(maxAllocMB)})
+		return
+	}
+	retain := c.Query("retain") == "true"
+	if retain && retainedBytes()+mb<<20 > maxRetainedMB<<20 {
+		c.JSON(http.StatusConflict, gin.H{"error": "ALLOC_MAX_RETAINED_MB would be exceeded, DELETE /admin/alloc first"})
+		return
+	}
+
+	before := readRuntimeMetrics()
+	chunks := make([][]byte, mb<<20/allocChunkSize)
+	for i := range chunks {
+		chunk := make([]byte, allocChunkSize)
+		for j := 0; j < len(chunk); j += 4096 {
+			chunk[j] = byte(i)
+		}
+		chunks[i] = chunk
+	}
+	if retain {
+		retained.Lock()
+		retained.chunks = append(retained.chunks, chunks...)
+		retained.Unlock()
+	}
+	after := readRuntimeMetrics()
+
+	slog.Debug("memory allocated",
+		"trace_id", traceIDFromContext(c.Request.Context()),
+		"mb", mb,
+		"retain", retain,
+		"gc_cycles", after.GCCycles-before.GCCycles,
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"allocated_mb":    mb,
+		"retained_bytes":  retainedBytes(),
+		"heap_live_bytes": after.HeapLiveBytes,
+		"gc_cycles":       after.GCCycles - before.GCCycles,
+		"gc_pause_max_ms": after.GCPauseMaxMs,
+	})
+}
+
+// freeFunc drops the memory retained by /alloc/:mb, for the next GC to
+// reclaim.
+func freeFunc(c *gin.Context) {
+	retained.Lock()
+	freed := len(retained.chunks) * allocChunkSize
+	retained.chunks = nil
+	retained.Unlock()
+	c.JSON(http.StatusOK, gin.H{"freed_bytes": freed})
+}
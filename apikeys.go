@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+
+	// apiKeyNameKey is the context key of the name of the request's API key.
+	apiKeyNameKey = "api_key.name"
+)
+
+// apiKeyRequests counts requests per API key name, and those rejected for
+// an unknown key or a rate limit.
+var apiKeyRequests = expvar.NewMap("api_keys")
+
+// apiKey is a row of the api_keys table. Keys are stored as SHA-256
+// hashes; RateLimit is in requests per minute.
+type apiKey struct {
+	Name      string `json:"name"`
+	RateLimit int64  `json:"rate_limit"`
+}
+
+var (
+	// apiKeyRequired rejects requests without an X-API-Key header.
+	apiKeyRequired = getEnv("API_KEY_REQUIRED", "false") == "true"
+
+	// apiKeyCacheTTL is how long keys looked up in MySQL are cached in
+	// Redis, and so how long a revoked key keeps working.
+	apiKeyCacheTTL = getEnvDuration("API_KEY_CACHE_TTL", 5*time.Minute)
+)
+
+// apiKeyMiddleware authenticates requests carrying an X-API-Key header
+// against the api_keys table, caching keys in Redis, and holds each key to
+// its own per-minute rate limit. Without Redis, keys aren't cached nor rate
+// limited. The key's name is put on the request for logs and metrics.
+// Requests without a key are let through unless API_KEY_REQUIRED is set;
+// health checks always are.
+func apiKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader(apiKeyHeader)
+		if raw == "" {
+			if apiKeyRequired && c.FullPath() != "/healthz" && c.FullPath() != "/readyz" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": apiKeyHeader + " header is required"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key, err := lookupAPIKey(ctx, raw)
+		if errors.Is(err, errNotFound) {
+			apiKeyRequests.Add("unknown", 1)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+			return
+		}
+		if err != nil {
+			slog.Warn("API key lookup failed", "trace_id", traceIDFromContext(ctx), "error", err)
+			respondError(c, http.StatusServiceUnavailable, "API key lookup error: %v", err)
+			c.Abort()
+			return
+		}
+		c.Set(apiKeyNameKey, key.Name)
+		apiKeyRequests.Add(key.Name+"_requests", 1)
+
+		if !stepAvailable("redis") {
+			c.Next()
+			return
+		}
+		now := clk.Now()
+		used, err := incrRateLimit(ctx, key.Name, now)
+		if err != nil {
+			// like the daily quota, the rate limit fails open
+			slog.Warn("rate limit check failed", "api_key", key.Name, "error", err)
+			c.Next()
+			return
+		}
+		reset := time.Minute - now.Sub(now.Truncate(time.Minute))
+		c.Header("X-RateLimit-Limit", strconv.FormatInt(key.RateLimit, 10))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(max(key.RateLimit-used, 0), 10))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(int(reset.Seconds())))
+		if used > key.RateLimit {
+			apiKeyRequests.Add(key.Name+"_limited", 1)
+			c.Header("Retry-After", strconv.Itoa(int(reset.Seconds())))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded", "api_key": key.Name})
+			return
+		}
+		c.Next()
+	}
+}
+
+// lookupAPIKey returns the unrevoked key raw hashes to, or errNotFound.
+// Unknown keys are cached too, so that guessing keys doesn't hit MySQL.
+func lookupAPIKey(ctx context.Context, raw string) (*apiKey, error) {
+	sum := sha256.Sum256([]byte(raw))
+	hash := hex.EncodeToString(sum[:])
+	cacheKey := "apikey:" + hash
+
+	// without Redis, keys are looked up in MySQL every time
+	useCache := stepAvailable("redis")
+	if useCache {
+		rctx, cancel := backendContext(ctx, "redis")
+		b, err := rdb.Get(rctx, cacheKey).Bytes()
+		cancel()
+		switch {
+		case err == nil && len(b) == 0:
+			return nil, errNotFound
+		case err == nil:
+			var key apiKey
+			if err = json.Unmarshal(b, &key); err == nil {
+				return &key, nil
+			}
+		case !errors.Is(err, redis.Nil):
+			slog.Warn("API key cache read failed", "error", err)
+		}
+	}
+
+	if !stepAvailable("migrations") {
+		return nil, errors.New("api_keys table is unavailable")
+	}
+	mctx, cancel := backendContext(ctx, "mysql")
+	defer cancel()
+	var key apiKey
+	err := mysqldb.QueryRowContext(mctx,
+		commented(mctx, "SELECT name, rate_limit FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL"),
+		hash).Scan(&key.Name, &key.RateLimit)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if useCache {
+		var cached []byte
+		ttl := apiKeyCacheTTL
+		if err == nil {
+			cached, _ = json.Marshal(key)
+		} else {
+			ttl = min(ttl, time.Minute)
+		}
+		rctx, cancel := backendContext(ctx, "redis")
+		defer cancel()
+		if cerr := rdb.Set(rctx, cacheKey, cached, ttl).Err(); cerr != nil {
+			slog.Warn("API key cache write failed", "error", cerr)
+		}
+	}
+	if err != nil {
+		return nil, errNotFound
+	}
+	return &key, nil
+}
+
+// incrRateLimit counts a request of the named key in the current minute.
+func incrRateLimit(ctx context.Context, name string, now time.Time) (int64, error) {
+	ctx, cancel := backendContext(ctx, "redis")
+	defer cancel()
+	key := "ratelimit:" + name + ":" + strconv.FormatInt(now.Unix()/60, 10)
+	pipe := rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, 2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
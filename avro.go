@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// kafkaEncoding is how the values of /kafka messages are encoded: raw, or
+// avro in the Confluent wire format with the schema kept in Schema Registry.
+var kafkaEncoding = getEnv("KAFKA_ENCODING", "raw")
+
+const sampleMessageSchema = `{
+	"type": "record",
+	"name": "SampleMessage",
+	"namespace": "com.cubeapm.sample",
+	"fields": [
+		{"name": "body", "type": "string"},
+		{"name": "produced_at", "type": {"type": "long", "logicalType": "timestamp-millis"}}
+	]
+}`
+
+// sampleMessageSubject follows the topic name strategy of Confluent's
+// serializers.
+const sampleMessageSubject = kafkaTopicName + "-value"
+
+var avroDecodeErrors = expvar.NewInt("avro_decode_errors")
+
+var registry = &schemaRegistry{
+	url:    getEnv("SCHEMA_REGISTRY_URL", "http://schema-registry:8081"),
+	ids:    map[string]int{},
+	codecs: map[int]*goavro.Codec{},
+}
+
+// schemaRegistry is a minimal Confluent Schema Registry client caching
+// registered schema IDs and the codecs of the schemas it has seen.
+type schemaRegistry struct {
+	url string
+
+	mu     sync.Mutex
+	ids    map[string]int
+	codecs map[int]*goavro.Codec
+}
+
+// register registers schema under subject, returning its ID.
+func (r *schemaRegistry) register(ctx context.Context, subject, schema string) (int, error) {
+	r.mu.Lock()
+	id, ok := r.ids[subject]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		ID int `json:"id"`
+	}
+	if err = r.call(ctx, http.MethodPost, "/subjects/"+subject+"/versions", body, &res); err != nil {
+		return 0, fmt.Errorf("registering schema for %s: %w", subject, err)
+	}
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	r.ids[subject] = res.ID
+	r.codecs[res.ID] = codec
+	r.mu.Unlock()
+	slog.Info("registered schema", "subject", subject, "schema_id", res.ID)
+	return res.ID, nil
+}
+
+// codec returns the codec of the schema with the given ID, fetching the
+// schema if it hasn't been seen yet.
+func (r *schemaRegistry) codec(ctx context.Context, id int) (*goavro.Codec, error) {
+	r.mu.Lock()
+	codec, ok := r.codecs[id]
+	r.mu.Unlock()
+	if ok {
+		return codec, nil
+	}
+
+	var res struct {
+		Schema string `json:"schema"`
+	}
+	if err := r.call(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &res); err != nil {
+		return nil, fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+	codec, err := goavro.NewCodec(res.Schema)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.codecs[id] = codec
+	r.mu.Unlock()
+	return codec, nil
+}
+
+func (r *schemaRegistry) call(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := hcl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("schema registry returned %s: %s", resp.Status, e.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// encodeMessageValue encodes the body of a /kafka message according to
+// kafkaEncoding.
+func encodeMessageValue(ctx context.Context, body string) ([]byte, error) {
+	if kafkaEncoding != "avro" {
+		return []byte(body), nil
+	}
+	id, err := registry.register(ctx, sampleMessageSubject, sampleMessageSchema)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := registry.codec(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Confluent wire format: magic byte 0, then the big endian schema ID
+	buf := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(buf[1:], uint32(id))
+	return codec.BinaryFromNative(buf, map[string]any{
+		"body":        body,
+		"produced_at": clk.Now(),
+	})
+}
+
+var errNotAvro = errors.New("value is not in the Avro wire format")
+
+// decodeMessageValue decodes the value of a /kafka message according to
+// kafkaEncoding, returning its body.
+func decodeMessageValue(ctx context.Context, value []byte) (string, error) {
+	if kafkaEncoding != "avro" {
+		return string(value), nil
+	}
+	if len(value) < 5 || value[0] != 0 {
+		return "", errNotAvro
+	}
+	id := int(binary.BigEndian.Uint32(value[1:5]))
+	codec, err := registry.codec(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	native, _, err := codec.NativeFromBinary(value[5:])
+	if err != nil {
+		return "", fmt.Errorf("decoding with schema %d: %w", id, err)
+	}
+	record, _ := native.(map[string]any)
+	body, _ := record["body"].(string)
+	return body, nil
+}
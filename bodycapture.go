@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"expvar"
+	"io"
+	"log/slog"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Body capture logs the request and response bodies of every request along
+// with its trace ID, for debugging support cases. Bodies may hold personal
+// data and secrets, so it's off unless BODY_CAPTURE is set or it's turned
+// on through /admin/tracer, and then:
+//
+//   - only JSON and form bodies are captured, as only their fields can be
+//     redacted; other bodies are noted by type and size only;
+//   - fields whose name contains a word of BODY_CAPTURE_DENY, in any case,
+//     have their values replaced, at any depth;
+//   - bodies over BODY_CAPTURE_PARSE_LIMIT bytes aren't captured, since
+//     they can't be redacted without reading them whole;
+//   - the redacted bodies are truncated to BODY_CAPTURE_MAX_BYTES.
+
+const redacted = "[REDACTED]"
+
+var (
+	bodyCaptureEnabled atomic.Bool
+
+	bodyCaptureMaxBytes   = getEnvInt("BODY_CAPTURE_MAX_BYTES", 2048)
+	bodyCaptureParseLimit = getEnvInt("BODY_CAPTURE_PARSE_LIMIT", 64*1024)
+	bodyCaptureDeny       = getEnvList("BODY_CAPTURE_DENY", "password,passwd,secret,token,authorization,api_key,apikey,card,cvv,ssn,email")
+
+	// bodyCaptureStats counts captured bodies, bodies noted without their
+	// content, and redacted fields.
+	bodyCaptureStats = expvar.NewMap("body_capture")
+)
+
+func init() {
+	bodyCaptureEnabled.Store(getEnv("BODY_CAPTURE", "false") == "true")
+}
+
+// bodyCaptureMiddleware logs the redacted bodies of each request and its
+// response while bodyCaptureEnabled is set.
+func bodyCaptureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !bodyCaptureEnabled.Load() {
+			c.Next()
+			return
+		}
+		reqBody := &limitedBuffer{limit: bodyCaptureParseLimit}
+		if c.Request.Body != nil {
+			c.Request.Body = readCloser{io.TeeReader(c.Request.Body, reqBody), c.Request.Body}
+		}
+		w := &capturingWriter{ResponseWriter: c.Writer, limit: bodyCaptureParseLimit}
+		c.Writer = w
+		c.Next()
+
+		// a body the handler didn't read to the end is incomplete too
+		reqBody.truncated = reqBody.truncated || int64(reqBody.buf.Len()) < c.Request.ContentLength
+		respSize := int64(w.body.Len())
+		if w.truncated {
+			respSize = -1
+		}
+		slog.Info("body capture",
+			"trace_id", traceIDFromContext(c.Request.Context()),
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"status", w.Status(),
+			"request_body", captureBody(c.ContentType(), reqBody.buf.Bytes(), c.Request.ContentLength, reqBody.truncated),
+			"response_body", captureBody(w.Header().Get("Content-Type"), w.body.Bytes(), respSize, w.truncated),
+		)
+	}
+}
+
+// captureBody returns the redacted and truncated body of the given content
+// type for the log, or a note of its type and size if it can't be redacted.
+// size is the size of the whole body, or -1 if unknown.
+func captureBody(contentType string, body []byte, size int64, incomplete bool) string {
+	if len(body) == 0 && !incomplete {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var (
+		out string
+		ok  bool
+	)
+	if !incomplete {
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			out, ok = redactJSON(body)
+		case mediaType == "application/x-www-form-urlencoded":
+			out, ok = redactForm(body)
+		}
+	}
+	if !ok {
+		bodyCaptureStats.Add("skipped", 1)
+		note := strconv.FormatInt(size, 10)
+		switch {
+		case size >= 0:
+		case incomplete:
+			note = "over " + strconv.Itoa(len(body))
+		default:
+			note = strconv.Itoa(len(body))
+		}
+		return "[" + cmp.Or(mediaType, "unknown type") + ", " + note + " bytes, not captured]"
+	}
+	bodyCaptureStats.Add("captured", 1)
+	if len(out) > bodyCaptureMaxBytes {
+		out = out[:bodyCaptureMaxBytes] + "...[truncated]"
+	}
+	return out
+}
+
+// redactJSON returns body with the values of deny-listed fields replaced.
+func redactJSON(body []byte) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+	b, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if deniedField(k) {
+				bodyCaptureStats.Add("redacted_fields", 1)
+				v[k] = redacted
+			} else {
+				v[k] = redactValue(field)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return v
+}
+
+// redactForm returns a URL-encoded form with the values of deny-listed
+// fields replaced.
+func redactForm(body []byte) (string, bool) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", false
+	}
+	for k, values := range form {
+		if deniedField(k) {
+			bodyCaptureStats.Add("redacted_fields", 1)
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return form.Encode(), true
+}
+
+// deniedField reports whether a field's name contains a word of
+// BODY_CAPTURE_DENY, e.g. "access_token" or "userPassword".
+func deniedField(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range bodyCaptureDeny {
+		if strings.Contains(name, strings.ToLower(word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedBuffer keeps the first limit bytes written to it, noting whether
+// there were more.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// readCloser reads from one reader and closes another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCaptureBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		size        int64
+		incomplete  bool
+		want        string
+	}{
+		{name: "empty", contentType: "application/json", want: ""},
+		{
+			name:        "json",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"user":"ann","password":"hunter2"}`,
+			want:        `{"password":"[REDACTED]","user":"ann"}`,
+		},
+		{
+			name:        "nested json",
+			contentType: "application/vnd.api+json",
+			body:        `{"items":[{"card_number":"4242","qty":2}],"auth":{"accessToken":"t"}}`,
+			want:        `{"auth":{"accessToken":"[REDACTED]"},"items":[{"card_number":"[REDACTED]","qty":2}]}`,
+		},
+		{
+			name:        "denied object",
+			contentType: "application/json",
+			body:        `{"secrets":{"a":1}}`,
+			want:        `{"secrets":"[REDACTED]"}`,
+		},
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "user=ann&Password=hunter2&token=a&token=b",
+			want:        "Password=%5BREDACTED%5D&token=%5BREDACTED%5D&token=%5BREDACTED%5D&user=ann",
+		},
+		{
+			name:        "invalid json",
+			contentType: "application/json",
+			body:        `{"password":`,
+			size:        12,
+			want:        "[application/json, 12 bytes, not captured]",
+		},
+		{
+			name:        "other type",
+			contentType: "image/png",
+			body:        "\x89PNG",
+			size:        -1,
+			want:        "[image/png, 4 bytes, not captured]",
+		},
+		{
+			name: "no type",
+			body: "data",
+			size: 4,
+			want: "[unknown type, 4 bytes, not captured]",
+		},
+		{
+			name:        "over the parse limit",
+			contentType: "application/json",
+			body:        `{"a":`,
+			size:        -1,
+			incomplete:  true,
+			want:        "[application/json, over 5 bytes, not captured]",
+		},
+		{
+			name:        "truncated",
+			contentType: "application/json",
+			body:        `{"note":"` + strings.Repeat("x", bodyCaptureMaxBytes) + `"}`,
+			want:        `{"note":"` + strings.Repeat("x", bodyCaptureMaxBytes-9) + "...[truncated]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := captureBody(tt.contentType, []byte(tt.body), tt.size, tt.incomplete)
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeniedField(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"password", true},
+		{"userPassword", true},
+		{"access_token", true},
+		{"API_KEY", true},
+		{"cardNumber", true},
+		{"name", false},
+		{"quantity", false},
+	}
+	for _, tt := range tests {
+		if got := deniedField(tt.name); got != tt.want {
+			t.Errorf("deniedField(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		writes        []string
+		want          string
+		wantTruncated bool
+	}{
+		{writes: []string{"abc"}, want: "abc"},
+		{writes: []string{"ab", "cd"}, want: "abcd"},
+		{writes: []string{"abc", "def"}, want: "abcd", wantTruncated: true},
+		{writes: []string{"abcdef", "g"}, want: "abcd", wantTruncated: true},
+	}
+	for _, tt := range tests {
+		b := &limitedBuffer{limit: 4}
+		for _, w := range tt.writes {
+			if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+				t.Fatalf("Write(%q) = %d, %v", w, n, err)
+			}
+		}
+		if b.buf.String() != tt.want || b.truncated != tt.wantTruncated {
+			t.Errorf("writes %q: got %q, truncated %v; want %q, truncated %v",
+				tt.writes, b.buf.String(), b.truncated, tt.want, tt.wantTruncated)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+)
+
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is a minimal consecutive-failure circuit breaker. It opens after
+// threshold consecutive failures and rejects calls until cooldown has
+// elapsed, after which a single trial call is let through.
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	clock     clock
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	trips    int
+	openedAt time.Time
+}
+
+var breakers = expvar.NewMap("breakers")
+
+func newBreaker(name string) *breaker {
+	b := &breaker{
+		name:      name,
+		threshold: getEnvInt("BREAKER_THRESHOLD", 5),
+		cooldown:  getEnvDuration("BREAKER_COOLDOWN", 30*time.Second),
+		clock:     clk,
+	}
+	breakers.Set(name, expvar.Func(func() any { return b.snapshot() }))
+	return b
+}
+
+// Do runs fn unless the breaker is open, recording its outcome. ctx is the
+// caller's context, not the one bounding the call: it's used to attribute
+// state changes to a request, and to tell calls the caller gave up on from
+// calls the backend failed.
+func (b *breaker) Do(ctx context.Context, fn func() error) error {
+	if !b.allow() {
+		return errBreakerOpen
+	}
+	err := fn()
+	b.record(ctx, err)
+	return err
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// a trial call is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if callerFailure(ctx, err) {
+		// says nothing about the backend; a trial call gets another go
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+		return
+	}
+	if err == nil {
+		if b.state != breakerClosed {
+			recordEvent(ctx, "breaker_closed", "%s breaker closed", b.name)
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.clock.Now()
+		b.trips++
+		recordEvent(ctx, "breaker_open", "%s breaker opened after %d failures: %v", b.name, b.failures, err)
+	}
+}
+
+func (b *breaker) snapshot() map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return map[string]any{
+		"state":    b.state.String(),
+		"failures": b.failures,
+		"trips":    b.trips,
+	}
+}
+
+// callerFailure reports whether err ended a call because of the caller
+// rather than the backend: the caller's ctx was cancelled or ran out, or
+// had too little time left for the call, as with a short X-Timeout-Ms.
+func callerFailure(ctx context.Context, err error) bool {
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) <= budgetReserve
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	errFail := errors.New("fail")
+	type call struct {
+		advance time.Duration
+		err     error
+		want    error
+		state   string
+	}
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "stays closed below the threshold",
+			calls: []call{
+				{err: errFail, want: errFail, state: "closed"},
+				{err: errFail, want: errFail, state: "closed"},
+				{err: nil, want: nil, state: "closed"},
+				{err: errFail, want: errFail, state: "closed"},
+				{err: errFail, want: errFail, state: "closed"},
+			},
+		},
+		{
+			name: "opens at the threshold and rejects calls",
+			calls: []call{
+				{err: errFail, want: errFail, state: "closed"},
+				{err: errFail, want: errFail, state: "closed"},
+				{err: errFail, want: errFail, state: "open"},
+				{err: nil, want: errBreakerOpen, state: "open"},
+				{advance: 59 * time.Second, err: nil, want: errBreakerOpen, state: "open"},
+			},
+		},
+		{
+			name: "closes after a successful trial call",
+			calls: []call{
+				{err: errFail, want: errFail},
+				{err: errFail, want: errFail},
+				{err: errFail, want: errFail, state: "open"},
+				{advance: time.Minute, err: nil, want: nil, state: "closed"},
+				{err: errFail, want: errFail, state: "closed"},
+			},
+		},
+		{
+			name: "reopens after a failed trial call",
+			calls: []call{
+				{err: errFail, want: errFail},
+				{err: errFail, want: errFail},
+				{err: errFail, want: errFail, state: "open"},
+				{advance: time.Minute, err: errFail, want: errFail, state: "open"},
+				{err: nil, want: errBreakerOpen, state: "open"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &offsetClock{}
+			b := &breaker{name: "test", threshold: 3, cooldown: time.Minute, clock: clock}
+			for i, c := range tt.calls {
+				clock.Advance(c.advance)
+				err := b.Do(context.Background(), func() error { return c.err })
+				if !errors.Is(err, c.want) || (c.want == nil && err != nil) {
+					t.Fatalf("call %d: got error %v, want %v", i, err, c.want)
+				}
+				if state := b.snapshot()["state"]; c.state != "" && state != c.state {
+					t.Fatalf("call %d: got state %v, want %s", i, state, c.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenLetsOneTrialThrough(t *testing.T) {
+	clock := &offsetClock{}
+	b := &breaker{name: "test", threshold: 1, cooldown: time.Minute, clock: clock}
+	_ = b.Do(context.Background(), func() error { return errors.New("fail") })
+	clock.Advance(time.Minute)
+
+	var nested error
+	err := b.Do(context.Background(), func() error {
+		nested = b.Do(context.Background(), func() error { return nil })
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("trial call: got error %v", err)
+	}
+	if !errors.Is(nested, errBreakerOpen) {
+		t.Fatalf("call during the trial: got error %v, want %v", nested, errBreakerOpen)
+	}
+}
+
+func TestBreakerIgnoresCallerDeadlines(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	short, cancel := context.WithTimeout(context.Background(), budgetReserve/2)
+	defer cancel()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		err   error
+		state string
+	}{
+		{name: "caller deadline passed", ctx: expired, err: context.DeadlineExceeded, state: "closed"},
+		{name: "caller deadline within the reserve", ctx: short, err: context.DeadlineExceeded, state: "closed"},
+		{name: "caller cancelled", ctx: cancelled, err: context.Canceled, state: "closed"},
+		{name: "backend timed out", ctx: context.Background(), err: context.DeadlineExceeded, state: "open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &breaker{name: "test", threshold: 3, cooldown: time.Minute, clock: &offsetClock{}}
+			for range 5 {
+				if err := b.Do(tt.ctx, func() error { return tt.err }); errors.Is(err, errBreakerOpen) {
+					break
+				}
+			}
+			if state := b.snapshot()["state"]; state != tt.state {
+				t.Fatalf("got state %v, want %s", state, tt.state)
+			}
+		})
+	}
+}
+
+func TestBreakerCallerDeadlineDuringTrial(t *testing.T) {
+	clock := &offsetClock{}
+	b := &breaker{name: "test", threshold: 1, cooldown: time.Minute, clock: clock}
+	_ = b.Do(context.Background(), func() error { return errors.New("fail") })
+	clock.Advance(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = b.Do(ctx, func() error { return context.Canceled })
+	if err := b.Do(context.Background(), func() error { return nil }); err != nil {
+		t.Fatalf("trial after a cancelled trial: got error %v", err)
+	}
+	if state := b.snapshot()["state"]; state != "closed" {
+		t.Fatalf("got state %v, want closed", state)
+	}
+}
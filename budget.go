@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"time"
+)
+
+// backendTimeouts are the default timeouts of a single call to each
+// backend, overridable with <BACKEND>_TIMEOUT, e.g. MYSQL_TIMEOUT=500ms.
+var backendTimeouts = map[string]time.Duration{
+	"mysql":      backendTimeout("mysql", 2*time.Second),
+	"mssql":      backendTimeout("mssql", 2*time.Second),
+	"redis":      backendTimeout("redis", 500*time.Millisecond),
+	"memcached":  backendTimeout("memcached", 500*time.Millisecond),
+	"etcd":       backendTimeout("etcd", time.Second),
+	"grpc":       backendTimeout("grpc", 5*time.Second),
+	"mongo":      backendTimeout("mongo", 2*time.Second),
+	"couchbase":  backendTimeout("couchbase", 2*time.Second),
+	"neo4j":      backendTimeout("neo4j", 2*time.Second),
+	"clickhouse": backendTimeout("clickhouse", 5*time.Second),
+	"kafka":      backendTimeout("kafka", 10*time.Second),
+}
+
+// budgetReserve is the part of the request's deadline kept back for
+// handling a backend failure and writing the response.
+var budgetReserve = getEnvDuration("TIMEOUT_RESERVE", 100*time.Millisecond)
+
+// budgetTightened counts, per backend, the calls whose timeout was cut
+// short by the remaining request budget.
+var budgetTightened = expvar.NewMap("budget_tightened")
+
+func backendTimeout(backend string, def time.Duration) time.Duration {
+	return getEnvDuration(strings.ToUpper(backend)+"_TIMEOUT", def)
+}
+
+// backendContext bounds ctx for a single call to backend by the backend's
+// default timeout or by what's left of the request's deadline minus
+// budgetReserve, whichever is shorter. Latency injected into the backend is
+// waited out before returning, and counts against the call's timeout.
+func backendContext(ctx context.Context, backend string) (context.Context, context.CancelFunc) {
+	timeout := backendTimeouts[backend]
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline) - budgetReserve; remaining < timeout {
+			timeout = max(remaining, 0)
+			budgetTightened.Add(backend, 1)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	if d := backendLatency(backend); d > 0 {
+		sleepCtx(ctx, d)
+	}
+	return ctx, cancel
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errBulkheadFull = errors.New("bulkhead full")
+
+// bulkheadStats publishes the state of every bulkhead by name.
+var bulkheadStats = expvar.NewMap("bulkheads")
+
+var (
+	// mysqlBulkhead and clickhouseBulkhead bound the concurrent calls of the
+	// request handlers to each backend, so that a flood of slow queries to
+	// one can't tie up the app's goroutines and connections for the other.
+	mysqlBulkhead      = newBulkhead("mysql", 10)
+	clickhouseBulkhead = newBulkhead("clickhouse", 4)
+)
+
+// bulkhead is a semaphore bounding the concurrent calls to a backend to
+// <BACKEND>_BULKHEAD. Calls finding it full wait for a slot for up to
+// <BACKEND>_BULKHEAD_WAIT.
+type bulkhead struct {
+	name    string
+	slots   chan struct{}
+	maxWait time.Duration
+
+	waiting  atomic.Int64
+	rejected atomic.Int64
+	waits    *latencyHistogram
+}
+
+type bulkheadSnapshot struct {
+	Limit     int     `json:"limit"`
+	InUse     int     `json:"in_use"`
+	Waiting   int64   `json:"waiting"`
+	Rejected  int64   `json:"rejected"`
+	WaitP50Ms float64 `json:"wait_p50_ms"`
+	WaitP95Ms float64 `json:"wait_p95_ms"`
+	WaitMaxMs float64 `json:"wait_max_ms"`
+}
+
+func newBulkhead(name string, limit int) *bulkhead {
+	prefix := strings.ToUpper(name) + "_BULKHEAD"
+	b := &bulkhead{
+		name:    name,
+		slots:   make(chan struct{}, max(getEnvInt(prefix, limit), 1)),
+		maxWait: getEnvDuration(prefix+"_WAIT", time.Second),
+		waits:   newLatencyHistogram(),
+	}
+	bulkheadStats.Set(name, expvar.Func(func() any { return b.snapshot() }))
+	return b
+}
+
+// acquire takes a slot, waiting for one if needed, and returns the function
+// giving it back. It returns errBulkheadFull if no slot freed up in time.
+func (b *bulkhead) acquire(ctx context.Context) (func(), error) {
+	start := clk.Now()
+	release := func() { <-b.slots }
+	select {
+	case b.slots <- struct{}{}:
+		b.waits.record(0)
+		return release, nil
+	default:
+	}
+
+	b.waiting.Add(1)
+	defer b.waiting.Add(-1)
+	select {
+	case b.slots <- struct{}{}:
+	case <-clk.After(b.maxWait):
+		b.rejected.Add(1)
+		return nil, fmt.Errorf("%w: %s", errBulkheadFull, b.name)
+	case <-ctx.Done():
+		b.rejected.Add(1)
+		return nil, ctx.Err()
+	}
+	wait := clk.Since(start)
+	b.waits.record(wait)
+	slog.Debug("bulkhead wait",
+		"trace_id", traceIDFromContext(ctx),
+		"bulkhead", b.name,
+		"wait", wait,
+	)
+	return release, nil
+}
+
+func (b *bulkhead) snapshot() bulkheadSnapshot {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return bulkheadSnapshot{
+		Limit:     cap(b.slots),
+		InUse:     len(b.slots),
+		Waiting:   b.waiting.Load(),
+		Rejected:  b.rejected.Load(),
+		WaitP50Ms: ms(b.waits.quantile(0.5)),
+		WaitP95Ms: ms(b.waits.quantile(0.95)),
+		WaitMaxMs: ms(b.waits.quantile(1)),
+	}
+}
+
+// respondBulkheadError answers 503 with a Retry-After when the bulkhead
+// stayed full, 504 when the request ran out of time waiting.
+func respondBulkheadError(c *gin.Context, err error) {
+	if errors.Is(err, errBulkheadFull) {
+		c.Header("Retry-After", "1")
+		respondError(c, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	respondError(c, http.StatusGatewayTimeout, "Bulkhead wait error: %v", err)
+}
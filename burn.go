@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxBurnMs = 60_000
+
+// burnFunc keeps a CPU busy hashing for :ms milliseconds, or until the
+// request is cancelled. The work runs with the trace ID as a pprof label, so
+// CPU profiles taken meanwhile attribute it to the trace.
+func burnFunc(c *gin.Context) {
+	ms, err := strconv.Atoi(c.Param("ms"))
+	if err != nil || ms < 1 || ms > maxBurnMs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ms must be between 1 and " + strconv.Itoa(maxBurnMs)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var (
+		rounds int
+		sum    [sha256.Size]byte
+	)
+	start := time.Now()
+	labels := pprof.Labels("trace_id", traceIDFromContext(ctx), "route", c.FullPath())
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		deadline := start.Add(time.Duration(ms) * time.Millisecond)
+		for ctx.Err() == nil && time.Now().Before(deadline) {
+			for range 1000 {
+				sum = sha256.Sum256(sum[:])
+			}
+			rounds += 1000
+		}
+	})
+	elapsed := time.Since(start)
+	slog.Debug("CPU burned",
+		"trace_id", traceIDFromContext(ctx),
+		"rounds", rounds,
+		"duration", elapsed,
+		"error", ctx.Err(),
+	)
+	if ctx.Err() != nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"requested_ms": ms,
+		"duration_ms":  elapsed.Milliseconds(),
+		"rounds":       rounds,
+		"sum":          hex.EncodeToString(sum[:8]),
+	})
+}
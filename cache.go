@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var errCacheMiss = errors.New("cache miss")
+
+// cache is the key-value cache behind the /redis endpoint: Redis normally,
+// or an in-process map with CACHE_BACKEND=memory or in LOCAL_MODE.
+type cache interface {
+	// Get returns errCacheMiss if key is not set.
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+}
+
+var appCache cache
+
+type redisCache struct {
+	client redis.UniversalClient
+}
+
+func (c redisCache) Get(ctx context.Context, key string) (string, error) {
+	val, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errCacheMiss
+	}
+	return val, err
+}
+
+func (c redisCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+type memoryCacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// memoryCache is a map based cache. Expired entries are dropped lazily.
+type memoryCache struct {
+	clock   clock
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+func newMemoryCache(clock clock) *memoryCache {
+	return &memoryCache{clock: clock, entries: map[string]memoryCacheEntry{}}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", errCacheMiss
+	}
+	if !e.expiresAt.IsZero() && c.clock.Now().After(e.expiresAt) {
+		delete(c.entries, key)
+		return "", errCacheMiss
+	}
+	return e.value, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := memoryCacheEntry{value: value}
+	if ttl > 0 {
+		e.expiresAt = c.clock.Now().Add(ttl)
+	}
+	c.entries[key] = e
+	return nil
+}
@@ -0,0 +1,28 @@
+#!/bin/sh
+# Generates a CA, a server certificate for localhost and the compose
+# hostnames, and a client certificate, for running the app with mTLS:
+#
+#   TLS_CERT_FILE=certs/server.crt TLS_KEY_FILE=certs/server.key
+#   TLS_CLIENT_CA_FILE=certs/ca.crt TLS_CA_FILE=certs/ca.crt
+#   TLS_CLIENT_CERT_FILE=certs/client.crt TLS_CLIENT_KEY_FILE=certs/client.key
+#
+# and then e.g.
+#
+#   curl --cacert certs/ca.crt --cert certs/client.crt --key certs/client.key https://localhost:8000/
+set -e
+cd "$(dirname "$0")"
+
+openssl req -x509 -newkey rsa:2048 -nodes -days 365 -subj "/CN=sample-app-ca" \
+	-keyout ca.key -out ca.crt
+
+openssl req -newkey rsa:2048 -nodes -subj "/CN=localhost" -keyout server.key -out server.csr
+printf "subjectAltName=DNS:localhost,DNS:go_net_http,DNS:go_net_http_eu,IP:127.0.0.1\nextendedKeyUsage=serverAuth\n" > server.ext
+openssl x509 -req -in server.csr -CA ca.crt -CAkey ca.key -CAcreateserial -days 365 \
+	-extfile server.ext -out server.crt
+
+openssl req -newkey rsa:2048 -nodes -subj "/O=sample-app/CN=sample-client" -keyout client.key -out client.csr
+printf "extendedKeyUsage=clientAuth\n" > client.ext
+openssl x509 -req -in client.csr -CA ca.crt -CAkey ca.key -CAcreateserial -days 365 \
+	-extfile client.ext -out client.crt
+
+rm -f server.csr server.ext client.csr client.ext ca.srl
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// linkHeader carries the traceparent of the write that caused a change, so
+// the trace that republishes it can be linked back to that write.
+const linkHeader = "link-traceparent"
+
+var orderChangesPublished = expvar.NewInt("order_changes_published")
+
+type orderChange struct {
+	Operation string `json:"operation"`
+	Order     Order  `json:"order"`
+}
+
+// runOrderWatcher republishes changes to the orders collection to Kafka
+// until ctx is done. Changes are processed in new traces, as they happen
+// after the request that wrote them has finished. The stream needs Mongo to
+// run as a replica set.
+func runOrderWatcher(ctx context.Context) {
+	if !stepAvailable("mongo") {
+		return
+	}
+	var resumeToken bson.Raw
+	for ctx.Err() == nil {
+		var err error
+		resumeToken, err = watchOrders(ctx, resumeToken)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("change stream: watching orders failed", "error", err)
+			sleepCtx(ctx, 5*time.Second)
+		}
+	}
+}
+
+// watchOrders watches the orders collection from resumeToken, if set, and
+// returns the token to resume from once the stream fails.
+func watchOrders(ctx context.Context, resumeToken bson.Raw) (bson.Raw, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+	stream, err := mdb.Database("sample_db").Collection("orders").Watch(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "update", "replace"}}}}}}},
+	}, opts)
+	if err != nil {
+		return resumeToken, err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var change struct {
+			OperationType string        `bson:"operationType"`
+			FullDocument  orderDocument `bson:"fullDocument"`
+		}
+		if err = stream.Decode(&change); err != nil {
+			return resumeToken, err
+		}
+		token := stream.ResumeToken()
+		if err = publishOrderChange(ctx, change.OperationType, change.FullDocument, token); err != nil {
+			return resumeToken, err
+		}
+		resumeToken = token
+	}
+	return resumeToken, stream.Err()
+}
+
+func publishOrderChange(ctx context.Context, op string, doc orderDocument, token bson.Raw) error {
+	ctx = context.WithValue(ctx, traceIDKey{}, randomHex(16))
+	value, err := json.Marshal(orderChange{Operation: op, Order: doc.order()})
+	if err != nil {
+		return err
+	}
+	headers := newMessageHeaders(ctx)
+	// the change's resume token is unique, so every instance watching the
+	// collection publishes the change under the same message ID
+	if data, ok := token.Lookup("_data").StringValueOK(); ok {
+		headers[messageIDHeader] = "order-change-" + data
+	}
+	if doc.Traceparent != "" {
+		headers[linkHeader] = doc.Traceparent
+	}
+
+	pctx, cancel := backendContext(ctx, "kafka")
+	defer cancel()
+	if err = bus.Produce(pctx, message{Key: []byte(doc.ID.Hex()), Value: value, Headers: headers}); err != nil {
+		return err
+	}
+	orderChangesPublished.Add(1)
+	slog.Debug("change stream: published order change",
+		"trace_id", traceIDFromContext(ctx),
+		"linked_traceparent", doc.Traceparent,
+		"order_id", doc.ID.Hex(),
+		"operation", op,
+	)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"expvar"
+	"time"
+)
+
+// injectedLatency is the latency added to every call to a backend, in
+// milliseconds by backend name. Scenarios set it to slow backends down.
+var injectedLatency = expvar.NewMap("injected_latency_ms")
+
+// setInjectedLatency adds d to every call to backend from now on, or stops
+// adding latency if d is 0.
+func setInjectedLatency(backend string, d time.Duration) {
+	if d <= 0 {
+		injectedLatency.Delete(backend)
+		return
+	}
+	v := new(expvar.Int)
+	v.Set(d.Milliseconds())
+	injectedLatency.Set(backend, v)
+}
+
+func backendLatency(backend string) time.Duration {
+	if v, ok := injectedLatency.Get(backend).(*expvar.Int); ok {
+		return time.Duration(v.Value()) * time.Millisecond
+	}
+	return 0
+}
+
+// disableStep marks the named startup step unavailable, as if its backend
+// had gone down, and reports whether it was available until then.
+func disableStep(name string) bool {
+	_, loaded := unavailableSteps.LoadOrStore(name, true)
+	return !loaded
+}
+
+// enableStep makes a step disabled with disableStep available again.
+func enableStep(name string) {
+	unavailableSteps.Delete(name)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clock tells the time used for timestamps, TTLs, cooldowns and latencies,
+// and waits. Deadlines, which the runtime and the OS enforce in real time,
+// always use real time.
+type clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// offsetClock is the real clock shifted by an offset that can be advanced,
+// letting demos fast-forward through TTLs and cooldowns. Waits still take
+// their real duration.
+type offsetClock struct {
+	realClock
+	offset atomic.Int64
+}
+
+func (c *offsetClock) Now() time.Time {
+	return time.Now().Add(time.Duration(c.offset.Load()))
+}
+
+func (c *offsetClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *offsetClock) Advance(d time.Duration) {
+	c.offset.Add(int64(d))
+}
+
+func (c *offsetClock) Reset() {
+	c.offset.Store(0)
+}
+
+// clk is the app's clock. DEMO_CLOCK=true makes it adjustable through
+// /admin/clock.
+var clk = newClock()
+
+func newClock() clock {
+	if getEnv("DEMO_CLOCK", "false") == "true" {
+		return &offsetClock{}
+	}
+	return realClock{}
+}
+
+func getClockFunc(c *gin.Context) {
+	res := gin.H{"now": clk.Now().UTC()}
+	if oc, ok := clk.(*offsetClock); ok {
+		res["offset"] = time.Duration(oc.offset.Load()).String()
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// setClockFunc moves the demo clock forward, e.g. {"advance": "2h"}, or
+// back to real time with {"reset": true}.
+func setClockFunc(c *gin.Context) {
+	oc, ok := clk.(*offsetClock)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "clock is not adjustable, set DEMO_CLOCK=true"})
+		return
+	}
+	var req struct {
+		Advance string `json:"advance"`
+		Reset   bool   `json:"reset"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Reset {
+		oc.Reset()
+	}
+	if req.Advance != "" {
+		d, err := time.ParseDuration(req.Advance)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "advance must be a positive duration"})
+			return
+		}
+		oc.Advance(d)
+	}
+	recordEvent(c.Request.Context(), "config", "clock offset set to %s", time.Duration(oc.offset.Load()))
+	getClockFunc(c)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when advanced, or when something sleeps or waits on
+// it, which returns at once.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Since(t time.Time) time.Duration { return c.Now().Sub(t) }
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Sleep(d time.Duration) { c.Advance(d) }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Advance(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+// useClock makes c the app's clock for the rest of the test.
+func useClock(t *testing.T, c clock) {
+	prev := clk
+	clk = c
+	t.Cleanup(func() { clk = prev })
+}
+
+func TestOffsetClock(t *testing.T) {
+	c := &offsetClock{}
+	start := c.Now()
+	c.Advance(2 * time.Hour)
+	if d := c.Since(start); d < 2*time.Hour || d > 2*time.Hour+time.Minute {
+		t.Errorf("Since after advancing 2h = %s", d)
+	}
+	c.Reset()
+	if d := c.Since(start); d > time.Minute {
+		t.Errorf("Since after reset = %s", d)
+	}
+}
+
+func TestWorkerPoolLatencies(t *testing.T) {
+	useClock(t, newFakeClock())
+	p := newWorkerPool("clock-test", 1, 1)
+	for _, d := range []time.Duration{250 * time.Millisecond, 2 * time.Second} {
+		err := p.Do(context.Background(), "sleep", func(context.Context) error {
+			clk.Sleep(d)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := p.latencies.quantile(0.5); got != 250*time.Millisecond {
+		t.Errorf("median task latency = %s, want 250ms", got)
+	}
+	if got := p.latencies.quantile(1); got != 2*time.Second {
+		t.Errorf("max task latency = %s, want 2s", got)
+	}
+	if got := p.waits.quantile(1); got != 0 {
+		t.Errorf("max queue wait = %s, want 0", got)
+	}
+}
+
+func TestNodePoolCooldown(t *testing.T) {
+	tests := []struct {
+		elapsed time.Duration
+		healthy bool
+	}{
+		{0, false},
+		{30 * time.Second, false},
+		{time.Minute, false},
+		{time.Minute + time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.elapsed.String(), func(t *testing.T) {
+			fc := newFakeClock()
+			useClock(t, fc)
+			p, err := newNodePool("clock-test", []string{"a", "b"}, func(addr string) (string, error) { return addr, nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.cooldown = time.Minute
+			_ = p.Do(context.Background(), func(context.Context, string, string) error {
+				return errors.New("down")
+			})
+			fc.Advance(tt.elapsed)
+			for _, n := range p.nodes {
+				if got := p.healthy(n); got != tt.healthy {
+					t.Errorf("node %s healthy = %v, want %v", n.addr, got, tt.healthy)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkheadMaxWait(t *testing.T) {
+	fc := newFakeClock()
+	useClock(t, fc)
+	b := newBulkhead("clock-test", 1)
+	b.maxWait = time.Hour
+	release, err := b.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	start := fc.Now()
+	if _, err = b.acquire(context.Background()); !errors.Is(err, errBulkheadFull) {
+		t.Fatalf("got error %v, want %v", err, errBulkheadFull)
+	}
+	if waited := fc.Since(start); waited != time.Hour {
+		t.Errorf("waited %s, want 1h", waited)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var apiCoalesced = expvar.NewInt("api_coalesced")
+
+// apiCallTimeout bounds the shared upstream call for callers without a
+// deadline.
+const apiCallTimeout = 10 * time.Second
+
+// coalescingFetcher merges identical GET requests: concurrent callers share
+// a single upstream call, and its result is reused by callers arriving
+// within window after it completed. Requests are identical when they have
+// the same URL and baggage, so tenants never share calls.
+//
+// The shared call carries the trace context and request ID of the caller
+// that started it, the leader: the others' contexts aren't propagated
+// upstream, and their logs link to the leader's trace instead.
+type coalescingFetcher struct {
+	client *http.Client
+	clock  clock
+	window time.Duration
+	group  singleflight.Group
+
+	mu     sync.Mutex
+	recent map[string]fetchResult
+	calls  map[string]*sharedCall
+}
+
+type fetchResult struct {
+	body      []byte
+	traceID   string
+	expiresAt time.Time
+}
+
+var apiFetcher = &coalescingFetcher{
+	client: &hcl,
+	clock:  clk,
+	window: getEnvDuration("API_COALESCE_WINDOW", 100*time.Millisecond),
+	recent: map[string]fetchResult{},
+	calls:  map[string]*sharedCall{},
+}
+
+// Get returns the body of url and whether it was served from another
+// caller's request. A caller gives up when its ctx is done, without
+// cancelling the call for the others.
+func (f *coalescingFetcher) Get(ctx context.Context, url string) ([]byte, bool, error) {
+	key := coalesceKey(ctx, url)
+	f.mu.Lock()
+	if r, ok := f.recent[key]; ok && f.clock.Now().Before(r.expiresAt) {
+		f.mu.Unlock()
+		coalesced(ctx, r.traceID)
+		return r.body, true, nil
+	}
+	call := f.calls[key]
+	if call == nil {
+		call = newSharedCall(ctx)
+		f.calls[key] = call
+	} else {
+		call.join(ctx)
+	}
+	f.mu.Unlock()
+
+	led := false
+	ch := f.group.DoChan(key, func() (any, error) {
+		led = true
+		return f.share(ctx, key, url, call)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, false, res.Err
+		}
+		r := res.Val.(fetchResult)
+		if led {
+			return r.body, false, nil
+		}
+		coalesced(ctx, r.traceID)
+		return r.body, true, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// coalesceKey identifies the requests to url that may share an upstream
+// call: those whose context sets the same request headers, bar the trace
+// context and request ID, which are the leader's.
+func coalesceKey(ctx context.Context, url string) string {
+	return url + "\n" + baggageFromContext(ctx)
+}
+
+// coalesced counts a request served from the call of the leader whose trace
+// is traceID, and logs the link between the two traces.
+func coalesced(ctx context.Context, traceID string) {
+	apiCoalesced.Add(1)
+	slog.Debug("coalesced API call", "trace_id", traceIDFromContext(ctx), "link_trace_id", traceID)
+}
+
+// share makes the upstream call shared by the callers with key, and keeps
+// its result for window.
+func (f *coalescingFetcher) share(ctx context.Context, key, url string, call *sharedCall) (fetchResult, error) {
+	f.mu.Lock()
+	if call.Err() != nil {
+		// the call joined finished before this flight started
+		call = newSharedCall(ctx)
+		f.calls[key] = call
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		if f.calls[key] == call {
+			delete(f.calls, key)
+		}
+		f.mu.Unlock()
+		call.finish()
+	}()
+
+	body, err := retry(call, apiRetry, func(ctx context.Context) ([]byte, error) {
+		return f.fetch(ctx, url)
+	})
+	if err != nil {
+		return fetchResult{}, err
+	}
+	r := fetchResult{body: body, traceID: traceIDFromContext(call), expiresAt: f.clock.Now().Add(f.window)}
+	f.mu.Lock()
+	f.recent[key] = r
+	f.mu.Unlock()
+	time.AfterFunc(f.window, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if r, ok := f.recent[key]; ok && !f.clock.Now().Before(r.expiresAt) {
+			delete(f.recent, key)
+		}
+	})
+	return r, nil
+}
+
+// sharedCall is the context of an upstream call shared by several callers.
+// It carries the values of the first caller's context but not its
+// cancellation, and its deadline is the latest of the callers' deadlines:
+// it runs as long as one of them may still be waiting, and no longer.
+type sharedCall struct {
+	context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+	expired  bool
+}
+
+func newSharedCall(ctx context.Context) *sharedCall {
+	s := &sharedCall{deadline: callerDeadline(ctx)}
+	s.Context, s.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	s.timer = time.AfterFunc(time.Until(s.deadline), s.expire)
+	return s
+}
+
+// callerDeadline returns the deadline of ctx, or apiCallTimeout from now if
+// it has none.
+func callerDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	return time.Now().Add(apiCallTimeout)
+}
+
+// join extends the call's deadline to that of another caller's ctx, if
+// later.
+func (s *sharedCall) join(ctx context.Context) {
+	deadline := callerDeadline(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if deadline.After(s.deadline) {
+		s.deadline = deadline
+		s.timer.Reset(time.Until(deadline))
+	}
+}
+
+func (s *sharedCall) expire() {
+	s.mu.Lock()
+	s.expired = true
+	s.mu.Unlock()
+	s.cancel()
+}
+
+func (s *sharedCall) finish() {
+	s.timer.Stop()
+	s.cancel()
+}
+
+func (s *sharedCall) Deadline() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deadline, true
+}
+
+func (s *sharedCall) Err() error {
+	err := s.Context.Err()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && s.expired {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (f *coalescingFetcher) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	setPropagationHeaders(ctx, req)
+	if t := timeoutFromContext(ctx); t != "" {
+		req.Header.Set(timeoutHeader, t)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return nil, fmt.Errorf("upstream responded %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalescingFetcherKeepsTenantsApart(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte(tenantFromBaggage(r.Header.Get("baggage"))))
+	}))
+	defer upstream.Close()
+
+	f := &coalescingFetcher{
+		client: upstream.Client(),
+		clock:  newFakeClock(),
+		window: time.Minute,
+		recent: map[string]fetchResult{},
+		calls:  map[string]*sharedCall{},
+	}
+	tenants := []string{"acme", "acme", "globex", "globex", ""}
+	type result struct {
+		body      string
+		coalesced bool
+	}
+	results := make([]result, len(tenants))
+	var wg sync.WaitGroup
+	for i, tenant := range tenants {
+		ctx := context.Background()
+		if tenant != "" {
+			ctx = context.WithValue(ctx, tenantKey{}, tenant)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, coalesced, err := f.Get(ctx, upstream.URL)
+			if err != nil {
+				t.Errorf("tenant %q: %v", tenant, err)
+			}
+			results[i] = result{string(body), coalesced}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	coalesced := 0
+	for i, r := range results {
+		if r.body != tenants[i] {
+			t.Errorf("tenant %q got the response for %q", tenants[i], r.body)
+		}
+		if r.coalesced {
+			coalesced++
+		}
+	}
+	// at most one of each tenant's callers is served from the other's call
+	if coalesced > 2 {
+		t.Errorf("got %d coalesced calls, want at most 2", coalesced)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"compress/gzip"
+	"expvar"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// compressionStats counts, per encoding, the compressed responses and
+// their bytes before and after compression.
+var compressionStats = expvar.NewMap("compression")
+
+// maxLargeItems caps the size of /large responses.
+const maxLargeItems = 100000
+
+// compressibleTypes are the content types worth compressing; images,
+// archives and the like are compressed already.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-ndjson",
+	"image/svg+xml",
+}
+
+// compressMiddleware compresses responses of at least COMPRESSION_MIN_SIZE
+// bytes with brotli or gzip, whichever the client accepts, preferring
+// brotli. The levels are set with COMPRESSION_BROTLI_LEVEL and
+// COMPRESSION_GZIP_LEVEL; COMPRESSION=false turns compression off.
+func compressMiddleware() gin.HandlerFunc {
+	if getEnv("COMPRESSION", "true") != "true" {
+		return func(c *gin.Context) { c.Next() }
+	}
+	minSize := getEnvInt("COMPRESSION_MIN_SIZE", 1024)
+	gzipLevel := getEnvInt("COMPRESSION_GZIP_LEVEL", 5)
+	brotliLevel := getEnvInt("COMPRESSION_BROTLI_LEVEL", 4)
+	if _, err := gzip.NewWriterLevel(io.Discard, gzipLevel); err != nil {
+		gzipLevel = gzip.DefaultCompression
+	}
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			w, _ := gzip.NewWriterLevel(io.Discard, gzipLevel)
+			return w
+		}},
+		"br": {New: func() any { return brotli.NewWriterLevel(io.Discard, brotliLevel) }},
+	}
+
+	return func(c *gin.Context) {
+		encoding := acceptedEncoding(c.GetHeader("Accept-Encoding"))
+		// websockets take over the connection; HEAD responses have no body
+		if encoding == "" || c.GetHeader("Upgrade") != "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		w := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			pool:           pools[encoding],
+			minSize:        minSize,
+		}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Header("Vary", "Accept-Encoding")
+		c.Next()
+	}
+}
+
+// acceptedEncoding returns br or gzip if the Accept-Encoding header value
+// accepts it, preferring br, or "" otherwise.
+func acceptedEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		accepted[strings.ToLower(name)] = q > 0
+	}
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter holds back the start of the response until it knows
+// whether the response is worth compressing: once minSize bytes have been
+// written, or the handler flushes, or the response ends.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+	minSize  int
+
+	buf     []byte
+	decided bool
+	enc     compressor
+	in      int
+}
+
+// compressor is what *gzip.Writer and *brotli.Writer have in common.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.in += len(b)
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		return len(b), w.decide(true)
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow sends the headers as they are, so the response can't be
+// compressed any more.
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Flush compresses a streamed response regardless of its size so far.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) decide(big bool) error {
+	w.decided = true
+	if big && w.compressible() {
+		h := w.Header()
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.enc = w.pool.Get().(compressor)
+		w.enc.Reset(w.ResponseWriter)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" && len(w.buf) > 0 {
+		ct = http.DetectContentType(w.buf)
+	}
+	mediaType, _, _ := mime.ParseMediaType(ct)
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// finish writes out what's still held back and ends the compressed stream.
+func (w *compressWriter) finish() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.enc == nil {
+		return
+	}
+	_ = w.enc.Close()
+	w.enc.Reset(io.Discard)
+	w.pool.Put(w.enc)
+	compressionStats.Add(w.encoding+"_responses", 1)
+	compressionStats.Add(w.encoding+"_bytes_in", int64(w.in))
+	compressionStats.Add(w.encoding+"_bytes_out", int64(w.ResponseWriter.Size()))
+}
+
+// largeFunc returns a JSON catalogue of ?items= products, large enough
+// (about 150 bytes per item) for compression to show in response sizes
+// and latencies.
+func largeFunc(c *gin.Context) {
+	items, err := strconv.Atoi(c.DefaultQuery("items", "1000"))
+	if err != nil || items < 1 || items > maxLargeItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "items must be between 1 and " + strconv.Itoa(maxLargeItems)})
+		return
+	}
+	products := make([]product, items)
+	for i := range products {
+		products[i] = product{
+			ID:    int64(i + 1),
+			Name:  "Product " + strconv.Itoa(i+1),
+			Price: float64(100+i%900) / 10,
+			Tags:  []string{"catalogue", "category-" + strconv.Itoa(i%10)},
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "products": products})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"GZIP;q=0.5", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+	}
+	for _, tt := range tests {
+		if got := acceptedEncoding(tt.header); got != tt.want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressWriter(t *testing.T) {
+	big := strings.Repeat("compressible text ", 200)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		status         int
+		body           string
+		flush          bool
+		wantEncoding   string
+	}{
+		{name: "gzip", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusOK, body: big, wantEncoding: "gzip"},
+		{name: "brotli preferred", acceptEncoding: "gzip, br", contentType: "text/plain", status: http.StatusOK, body: big, wantEncoding: "br"},
+		{name: "not accepted", acceptEncoding: "", contentType: "application/json", status: http.StatusOK, body: big},
+		{name: "too small", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusOK, body: "{}"},
+		{name: "already compressed type", acceptEncoding: "gzip", contentType: "image/png", status: http.StatusOK, body: big},
+		{name: "error status", acceptEncoding: "gzip", contentType: "text/plain", status: http.StatusInternalServerError, body: big, wantEncoding: "gzip"},
+		{name: "small but flushed", acceptEncoding: "gzip", contentType: "text/event-stream", status: http.StatusOK, body: "data: 1\n\n", flush: true, wantEncoding: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(compressMiddleware())
+			r.GET("/", func(c *gin.Context) {
+				c.Header("Content-Type", tt.contentType)
+				c.Status(tt.status)
+				_, _ = c.Writer.WriteString(tt.body)
+				if tt.flush {
+					c.Writer.Flush()
+				}
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("got Content-Encoding %q, want %q", got, tt.wantEncoding)
+			}
+			var body io.Reader = w.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			case "br":
+				body = brotli.NewReader(w.Body)
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("got body of %d bytes, want %d", len(got), len(tt.body))
+			}
+		})
+	}
+}
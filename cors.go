@@ -0,0 +1,92 @@
+package main
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// untracedKey marks requests that are left out of request logs and stats.
+const untracedKey = "untraced"
+
+// corsAllowedHeaders are the request headers browser frontends may send by
+// default: those the app reads, and the trace context to propagate.
+var corsAllowedHeaders = []string{
+	"Content-Type",
+	"Authorization",
+	"traceparent",
+	"baggage",
+	requestIDHeader,
+	tenantHeader,
+	apiKeyHeader,
+	idempotencyHeader,
+	timeoutHeader,
+}
+
+// corsRequests counts preflight and cross-origin requests, and the
+// requests from origins that aren't allowed.
+var corsRequests = expvar.NewMap("cors")
+
+// corsMiddleware lets browser frontends served from CORS_ALLOWED_ORIGINS
+// (comma-separated, "*" for any) call the API. CORS_ALLOWED_METHODS and
+// CORS_ALLOWED_HEADERS list what they may send; the trace and request ID
+// headers are exposed to them. Preflight requests are answered here, and
+// are left out of request logs and stats when CORS_TRACE_PREFLIGHT=false.
+// Without allowed origins, CORS is off.
+func corsMiddleware() gin.HandlerFunc {
+	origins := getEnvList("CORS_ALLOWED_ORIGINS", "")
+	if len(origins) == 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	config := cors.Config{
+		AllowMethods:     getEnvList("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE"),
+		AllowHeaders:     getEnvList("CORS_ALLOWED_HEADERS", strings.Join(corsAllowedHeaders, ",")),
+		ExposeHeaders:    []string{"X-Trace-Id", "traceparent", requestIDHeader, "API-Version", "Deprecation", "Sunset", "Link"},
+		AllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		MaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+	}
+	if len(origins) == 1 && origins[0] == "*" {
+		config.AllowAllOrigins = true
+	} else {
+		config.AllowOrigins = origins
+	}
+	if err := config.Validate(); err != nil {
+		slog.Error("invalid CORS configuration, CORS is off", "error", err)
+		return func(c *gin.Context) { c.Next() }
+	}
+	handler := cors.New(config)
+	tracePreflight := getEnv("CORS_TRACE_PREFLIGHT", "true") == "true"
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		switch {
+		case preflight:
+			corsRequests.Add("preflight", 1)
+			if !tracePreflight {
+				c.Set(untracedKey, true)
+			}
+		default:
+			corsRequests.Add("cross_origin", 1)
+		}
+		handler(c)
+		if c.IsAborted() && c.Writer.Status() == http.StatusForbidden {
+			corsRequests.Add("rejected", 1)
+			slog.Info("CORS request from disallowed origin",
+				"trace_id", traceIDFromContext(c.Request.Context()),
+				"origin", origin,
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+			)
+		}
+	}
+}
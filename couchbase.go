@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/couchbase/gocb/v2"
+	"github.com/gin-gonic/gin"
+)
+
+var cbc *gocb.Collection
+
+func initCouchbase(ctx context.Context) error {
+	cluster, err := gocb.Connect(getEnv("COUCHBASE_URL", "couchbase://couchbase"), gocb.ClusterOptions{
+		Authenticator: gocb.PasswordAuthenticator{
+			Username: getEnv("COUCHBASE_USERNAME", "Administrator"),
+			Password: getEnv("COUCHBASE_PASSWORD", "password"),
+		},
+		TimeoutsConfig: gocb.TimeoutsConfig{KVTimeout: backendTimeouts["couchbase"]},
+	})
+	if err != nil {
+		return err
+	}
+	bucket := cluster.Bucket(getEnv("COUCHBASE_BUCKET", "demo"))
+	if err = bucket.WaitUntilReady(10*time.Second, &gocb.WaitUntilReadyOptions{Context: ctx}); err != nil {
+		_ = cluster.Close(nil)
+		return err
+	}
+	cbc = bucket.DefaultScope().Collection("_default")
+	return nil
+}
+
+var durabilityLevels = map[string]gocb.DurabilityLevel{
+	"none":                    gocb.DurabilityLevelNone,
+	"majority":                gocb.DurabilityLevelMajority,
+	"majority_persist_active": gocb.DurabilityLevelMajorityAndPersistOnMaster,
+	"persist_majority":        gocb.DurabilityLevelPersistToMajority,
+}
+
+// logCouchbaseOp logs a KV operation along with where it ran and how
+// durable it was required to be.
+func logCouchbaseOp(ctx context.Context, op, durability string, start time.Time, err error) {
+	slog.Debug("couchbase call",
+		"trace_id", traceIDFromContext(ctx),
+		"op", op,
+		"bucket", cbc.Bucket().Name(),
+		"scope", cbc.ScopeName(),
+		"collection", cbc.Name(),
+		"durability", durability,
+		"duration", clk.Since(start),
+		"error", err,
+	)
+}
+
+func couchbaseGetFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "couchbase")
+	defer cancel()
+	start := clk.Now()
+	res, err := cbc.Get(c.Param("key"), &gocb.GetOptions{Context: ctx})
+	logCouchbaseOp(ctx, "get", "", start, err)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Couchbase get error: %v", err)
+		return
+	}
+	var doc map[string]any
+	if err = res.Content(&doc); err != nil {
+		respondError(c, http.StatusInternalServerError, "Couchbase decode error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"document": doc, "cas": res.Cas()})
+}
+
+// couchbaseUpsertFunc stores the JSON body under the key, with the
+// durability requested by ?durability=, e.g. majority.
+func couchbaseUpsertFunc(c *gin.Context) {
+	var doc map[string]any
+	if !bindJSON(c, &doc) {
+		return
+	}
+	durability := c.DefaultQuery("durability", "none")
+	level, ok := durabilityLevels[durability]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown durability " + durability})
+		return
+	}
+	ctx, cancel := backendContext(c.Request.Context(), "couchbase")
+	defer cancel()
+	start := clk.Now()
+	res, err := cbc.Upsert(c.Param("key"), doc, &gocb.UpsertOptions{Context: ctx, DurabilityLevel: level})
+	logCouchbaseOp(ctx, "upsert", durability, start, err)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Couchbase upsert error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cas": res.Cas()})
+}
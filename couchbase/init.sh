@@ -0,0 +1,13 @@
+#!/bin/sh
+# Initializes a single node Couchbase cluster with the demo bucket.
+set -e
+
+until couchbase-cli server-list -c couchbase:8091 -u Administrator -p password >/dev/null 2>&1 ||
+	couchbase-cli cluster-init -c couchbase:8091 \
+		--cluster-username Administrator --cluster-password password \
+		--services data --cluster-ramsize 512 >/dev/null 2>&1; do
+	sleep 2
+done
+
+couchbase-cli bucket-create -c couchbase:8091 -u Administrator -p password \
+	--bucket demo --bucket-type couchbase --bucket-ramsize 128 --wait || true
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/automaxprocs/maxprocs"
+)
+
+// cpuQuota is the container's CPU limit in cores, 0 when unlimited.
+var cpuQuota = expvar.NewFloat("cpu_quota")
+
+// initMaxProcs sets GOMAXPROCS to the container's CPU limit, so that the
+// scheduler doesn't run more threads than the quota lets execute and
+// throttling doesn't distort latencies.
+func initMaxProcs() {
+	_, err := maxprocs.Set(maxprocs.Logger(func(format string, args ...any) {
+		slog.Info(fmt.Sprintf(format, args...))
+	}))
+	if err != nil {
+		slog.Warn("failed to set GOMAXPROCS from CPU quota", "error", err)
+	}
+	if quota, ok := readCPUQuota(); ok {
+		cpuQuota.Set(quota)
+	}
+	slog.Info("cpu", "quota", cpuQuota.Value(), "gomaxprocs", runtime.GOMAXPROCS(0), "num_cpu", runtime.NumCPU())
+}
+
+// readCPUQuota reads the CPU limit from cgroup v2, falling back to v1.
+func readCPUQuota() (float64, bool) {
+	if b, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		quota, period, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+		return cpuRatio(quota, period)
+	}
+	quota, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0, false
+	}
+	return cpuRatio(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func cpuRatio(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		// "max" or -1 mean unlimited
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
+
+func debugCPUQuotaFunc(c *gin.Context) {
+	quota, limited := readCPUQuota()
+	c.JSON(http.StatusOK, gin.H{
+		"limited":    limited,
+		"quota":      quota,
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"num_cpu":    runtime.NumCPU(),
+	})
+}
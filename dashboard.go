@@ -0,0 +1,84 @@
+package main
+
+import (
+	"cmp"
+	"embed"
+	"expvar"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// templatesFS holds the HTML templates rendered through gin.
+//
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var dashboardRefresh = getEnvDuration("DASHBOARD_REFRESH", 10*time.Second)
+
+// templateRenders counts the renders of each template and their total
+// duration in microseconds.
+var templateRenders = expvar.NewMap("template_renders")
+
+// loadTemplates parses the embedded templates for c.HTML.
+func loadTemplates(engine *gin.Engine) {
+	engine.SetHTMLTemplate(template.Must(template.ParseFS(templatesFS, "templates/*.html")))
+}
+
+type dashboardBreaker struct {
+	Name     string
+	State    string
+	Failures any
+	Trips    any
+}
+
+// dashboardFunc renders a page of the instance's state: readiness, backend
+// circuit breakers and per-route request stats over the stats window. It
+// reloads itself every DASHBOARD_REFRESH.
+func dashboardFunc(c *gin.Context) {
+	routes := summarizeRoutes(reqStats.since(statsWindow))
+	slices.SortFunc(routes, func(a, b *routeSummary) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	total := 0
+	for _, r := range routes {
+		total += r.Count
+	}
+	var breakers []dashboardBreaker
+	for _, b := range []*breaker{mysqlBreaker, mongoBreaker, clickhouseBreaker} {
+		snap := b.snapshot()
+		breakers = append(breakers, dashboardBreaker{
+			Name:     b.name,
+			State:    snap["state"].(string),
+			Failures: snap["failures"],
+			Trips:    snap["trips"],
+		})
+	}
+
+	start := clk.Now()
+	c.HTML(http.StatusOK, "dashboard.html", gin.H{
+		"Instance":       instanceID,
+		"Region":         region,
+		"Ready":          ready.Load(),
+		"InFlight":       reqStats.inFlight.Load(),
+		"Total":          total,
+		"Window":         statsWindow,
+		"Breakers":       breakers,
+		"Routes":         routes,
+		"RefreshSeconds": int(dashboardRefresh.Seconds()),
+		"Now":            clk.Now(),
+	})
+	elapsed := clk.Since(start)
+	templateRenders.Add("dashboard.html_count", 1)
+	templateRenders.Add("dashboard.html_us", elapsed.Microseconds())
+	slog.Debug("template rendered",
+		"trace_id", traceIDFromContext(c.Request.Context()),
+		"template", "dashboard.html",
+		"routes", len(routes),
+		"duration", elapsed,
+	)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// messageIDHeader identifies a produced message across redeliveries.
+const messageIDHeader = "message-id"
+
+var (
+	consumerDuplicates = expvar.NewInt("kafka_duplicates")
+	dedupTTL           = getEnvDuration("DEDUP_TTL", 24*time.Hour)
+)
+
+// newMessageHeaders returns the headers of a new message: a unique ID for
+// consumer-side deduplication, and the trace context and tenant of ctx.
+func newMessageHeaders(ctx context.Context) map[string]string {
+	headers := map[string]string{
+		messageIDHeader: uuid.NewString(),
+		"traceparent":   traceparentFromContext(ctx),
+	}
+	if b := baggageFromContext(ctx); b != "" {
+		headers["baggage"] = b
+	}
+	return headers
+}
+
+// firstDelivery claims m for processing and reports whether this is the
+// first time it has been seen within dedupTTL. A consumer failing to
+// process m gives up the claim with releaseDelivery, so that a redelivery
+// is processed again. Messages without an ID, or whose state can't be
+// checked, as without Redis, are treated as first deliveries, so the
+// consumer processes each message at least once.
+func firstDelivery(ctx context.Context, m message) bool {
+	id := m.Headers[messageIDHeader]
+	if id == "" || !stepAvailable("redis") {
+		return true
+	}
+	first, err := rdb.SetNX(ctx, dedupKey(id), clk.Now().Unix(), dedupTTL).Result()
+	if err != nil {
+		slog.Warn("dedup check failed", "message_id", id, "error", err)
+		return true
+	}
+	if !first {
+		consumerDuplicates.Add(1)
+		slog.Info("skipping duplicate message",
+			"message_id", id,
+			"link_trace_id", parseTraceparent(m.Headers["traceparent"]),
+		)
+	}
+	return first
+}
+
+// releaseDelivery gives up the claim firstDelivery took on m.
+func releaseDelivery(ctx context.Context, m message) {
+	id := m.Headers[messageIDHeader]
+	if id == "" || !stepAvailable("redis") {
+		return
+	}
+	if err := rdb.Del(ctx, dedupKey(id)).Err(); err != nil {
+		slog.Warn("dedup release failed", "message_id", id, "error", err)
+	}
+}
+
+func dedupKey(id string) string {
+	return "processed:" + id
+}
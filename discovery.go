@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// With DISCOVERY=consul the instance registers itself in Consul and finds
+// the downstream service through it rather than at a static address.
+var (
+	consulClient      *consul.Client
+	serviceName       = getEnv("SERVICE_NAME", "sample-gin")
+	downstreamService = getEnv("DOWNSTREAM_SERVICE", serviceName)
+)
+
+// discoveryLookups counts downstream lookups by outcome.
+var discoveryLookups = expvar.NewMap("discovery_lookups")
+
+func discoveryEnabled() bool {
+	return getEnv("DISCOVERY", "static") == "consul"
+}
+
+// initDiscovery registers the instance in Consul with a health check on
+// /healthz.
+func initDiscovery(ctx context.Context) error {
+	if !discoveryEnabled() {
+		return nil
+	}
+	cfg := consul.DefaultConfig()
+	cfg.Address = getEnv("CONSUL_ADDR", "consul:8500")
+	var err error
+	if consulClient, err = consul.NewClient(cfg); err != nil {
+		return err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	return consulClient.Agent().ServiceRegisterOpts(&consul.AgentServiceRegistration{
+		ID:      instanceID,
+		Name:    serviceName,
+		Address: host,
+		Port:    8000,
+		Meta:    map[string]string{"region": region},
+		Check: &consul.AgentServiceCheck{
+			HTTP:                           fmt.Sprintf("http://%s:8000/healthz", host),
+			Interval:                       "10s",
+			DeregisterCriticalServiceAfter: "1m",
+		},
+	}, consul.ServiceRegisterOpts{}.WithContext(ctx))
+}
+
+func deregisterDiscovery() {
+	if consulClient != nil {
+		_ = consulClient.Agent().ServiceDeregister(instanceID)
+	}
+}
+
+// downstreamURL returns the base URL of a healthy downstream instance,
+// picked at random among those Consul knows of.
+func downstreamURL(ctx context.Context) (string, error) {
+	if !discoveryEnabled() {
+		return "http://localhost:8000", nil
+	}
+	start := clk.Now()
+	entries, _, err := consulClient.Health().Service(downstreamService, "", true, (&consul.QueryOptions{}).WithContext(ctx))
+	slog.Debug("consul lookup",
+		"trace_id", traceIDFromContext(ctx),
+		"service", downstreamService,
+		"instances", len(entries),
+		"duration", clk.Since(start),
+		"error", err,
+	)
+	if err != nil {
+		discoveryLookups.Add("error", 1)
+		return "", err
+	}
+	if len(entries) == 0 {
+		discoveryLookups.Add("empty", 1)
+		return "", fmt.Errorf("no healthy %s instances", downstreamService)
+	}
+	discoveryLookups.Add("ok", 1)
+	svc := entries[rand.IntN(len(entries))].Service
+	return fmt.Sprintf("http://%s:%d", svc.Address, svc.Port), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var errNotFound = errors.New("not found")
+
+// User is a customer of the demo shop, stored in MySQL.
+type User struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name" binding:"required,max=255"`
+	Email     string    `json:"email" db:"email" binding:"required,email,max=255"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Order is a purchase made by a user, stored in Mongo.
+type Order struct {
+	ID        string    `json:"id"`
+	UserID    int64     `json:"user_id" binding:"required"`
+	Amount    float64   `json:"amount" binding:"required,gt=0"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Event is an analytics event, stored in ClickHouse.
+type Event struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind" binding:"required,max=64"`
+	UserID    int64     `json:"user_id"`
+	Payload   string    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserRepository stores users. Get returns errNotFound for unknown IDs.
+type UserRepository interface {
+	CreateUser(ctx context.Context, u *User) error
+	GetUser(ctx context.Context, id int64) (*User, error)
+	ListUsers(ctx context.Context, limit int) ([]User, error)
+}
+
+// OrderRepository stores orders. Get returns errNotFound for unknown IDs.
+type OrderRepository interface {
+	CreateOrder(ctx context.Context, o *Order) error
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	ListOrdersByUser(ctx context.Context, userID int64) ([]Order, error)
+}
+
+// EventRepository stores analytics events.
+type EventRepository interface {
+	InsertEvent(ctx context.Context, e *Event) error
+	// CountEventsByKind returns the number of events of each kind since t.
+	CountEventsByKind(ctx context.Context, since time.Time) (map[string]uint64, error)
+}
+
+var (
+	userRepo  UserRepository
+	orderRepo OrderRepository
+	eventRepo EventRepository
+
+	// gormUserRepo and sqlxUserRepo serve the /gorm and /sqlx routes from
+	// the same users table.
+	gormUserRepo UserRepository
+	sqlxUserRepo UserRepository
+)
+
+// initRepositories sets up the repositories and their schemas.
+func initRepositories(ctx context.Context) error {
+	users := &mysqlUserRepository{db: mysqldb}
+	orders := newMongoOrderRepository(mdb.Database("sample_db"))
+	if err := orders.migrate(ctx); err != nil {
+		return err
+	}
+	events := &clickhouseEventRepository{conn: ccn, writers: clickhouseWriters}
+	if err := events.migrate(ctx); err != nil {
+		return err
+	}
+	gormUsers, err := newGormUserRepository(mysqldb)
+	if err != nil {
+		return err
+	}
+	userRepo, orderRepo, eventRepo = users, orders, events
+	gormUserRepo = gormUsers
+	sqlxUserRepo = &sqlxUserRepository{db: sqlx.NewDb(mysqldb, "mysql")}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createUserFunc(repo UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var u User
+		if !bindJSON(c, &u) {
+			return
+		}
+		if err := repo.CreateUser(c.Request.Context(), &u); err != nil {
+			respondError(c, http.StatusInternalServerError, "Create user error: %v", err)
+			return
+		}
+		respond(c, http.StatusCreated, "", u)
+	}
+}
+
+func getUserFunc(repo UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		u, err := repo.GetUser(c.Request.Context(), id)
+		if errors.Is(err, errNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Get user error: %v", err)
+			return
+		}
+		respond(c, http.StatusOK, "", u)
+	}
+}
+
+func listUsersFunc(repo UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		users, err := repo.ListUsers(c.Request.Context(), limit)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "List users error: %v", err)
+			return
+		}
+		respond(c, http.StatusOK, "users", users)
+	}
+}
+
+func createOrderFunc(c *gin.Context) {
+	var o Order
+	if !bindJSON(c, &o) {
+		return
+	}
+	_, err := userRepo.GetUser(c.Request.Context(), o.UserID)
+	if errors.Is(err, errNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Get user error: %v", err)
+		return
+	}
+	if err = orderRepo.CreateOrder(c.Request.Context(), &o); err != nil {
+		respondError(c, http.StatusInternalServerError, "Create order error: %v", err)
+		return
+	}
+	respond(c, http.StatusCreated, "", o)
+}
+
+func getOrderFunc(c *gin.Context) {
+	o, err := orderRepo.GetOrder(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, errNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Get order error: %v", err)
+		return
+	}
+	respond(c, http.StatusOK, "", o)
+}
+
+func listUserOrdersFunc(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	orders, err := orderRepo.ListOrdersByUser(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "List orders error: %v", err)
+		return
+	}
+	respond(c, http.StatusOK, "orders", orders)
+}
+
+func createEventFunc(c *gin.Context) {
+	var e Event
+	if !bindJSON(c, &e) {
+		return
+	}
+	if err := eventRepo.InsertEvent(c.Request.Context(), &e); err != nil {
+		respondError(c, http.StatusInternalServerError, "Insert event error: %v", err)
+		return
+	}
+	respond(c, http.StatusCreated, "", e)
+}
+
+// eventStatsFunc counts events per kind over ?window= (default 1h).
+func eventStatsFunc(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "1h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window"})
+		return
+	}
+	counts, err := eventRepo.CountEventsByKind(c.Request.Context(), clk.Now().Add(-window))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Event stats error: %v", err)
+		return
+	}
+	respond(c, http.StatusOK, "", gin.H{"window": window.String(), "counts": counts})
+}
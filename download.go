@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadFiles are the files /download/:file serves, by name and size.
+// Their content is generated, so they take no disk space.
+var downloadFiles = map[string]int64{
+	"1mb.bin":   1 << 20,
+	"100mb.bin": 100 << 20,
+	"1gb.bin":   1 << 30,
+}
+
+// downloadModTime is the Last-Modified time of the generated files. It's
+// fixed so that conditional requests behave the same on every instance.
+var downloadModTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// downloadStats counts downloads by outcome, and the bytes served.
+var downloadStats = expvar.NewMap("downloads")
+
+// downloadFunc streams a generated file, honoring Range, If-Range and
+// If-Modified-Since. With ?kbps= the file is sent at that rate, making for
+// a download lasting as long as wanted; ROUTE_TIMEOUTS may need to allow
+// for it.
+func downloadFunc(c *gin.Context) {
+	name := c.Param("file")
+	size, ok := downloadFiles[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown file", "files": slices.Sorted(maps.Keys(downloadFiles))})
+		return
+	}
+	kbps, err := strconv.Atoi(c.DefaultQuery("kbps", "0"))
+	if err != nil || kbps < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kbps must be a non-negative number"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	w := &downloadWriter{ResponseWriter: c.Writer, ctx: ctx, bytesPerSecond: kbps * 1024}
+	start := clk.Now()
+	c.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(w, c.Request, name, downloadModTime, io.NewSectionReader(patternReader{}, 0, size))
+
+	status := c.Writer.Status()
+	switch status {
+	case http.StatusPartialContent:
+		downloadStats.Add("partial", 1)
+	case http.StatusNotModified:
+		downloadStats.Add("not_modified", 1)
+	case http.StatusOK:
+		downloadStats.Add("full", 1)
+	}
+	downloadStats.Add("bytes", w.written)
+	slog.Info("download served",
+		"trace_id", traceIDFromContext(ctx),
+		"file", name,
+		"range", c.GetHeader("Range"),
+		"status", status,
+		"bytes", w.written,
+		"size", size,
+		"duration", clk.Since(start),
+		"error", ctx.Err(),
+	)
+}
+
+// patternReader reads an endless repetition of payloadChunk.
+type patternReader struct{}
+
+func (patternReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		i := int((off + int64(n)) % int64(len(payloadChunk)))
+		n += copy(p[n:], payloadChunk[i:])
+	}
+	return n, nil
+}
+
+// downloadWriter counts the bytes written to the response and, if
+// bytesPerSecond is set, throttles writes to that rate until ctx is done.
+type downloadWriter struct {
+	http.ResponseWriter
+	ctx            context.Context
+	bytesPerSecond int
+	written        int64
+}
+
+func (w *downloadWriter) Write(p []byte) (int, error) {
+	if w.bytesPerSecond == 0 {
+		n, err := w.ResponseWriter.Write(p)
+		w.written += int64(n)
+		return n, err
+	}
+	total := 0
+	for len(p) > 0 {
+		if err := w.ctx.Err(); err != nil {
+			return total, err
+		}
+		chunk := p[:min(len(p), max(w.bytesPerSecond/10, 1))]
+		n, err := w.ResponseWriter.Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		w.ResponseWriter.(http.Flusher).Flush()
+		p = p[n:]
+		sleepCtx(w.ctx, time.Duration(n)*time.Second/time.Duration(w.bytesPerSecond))
+	}
+	return total, nil
+}
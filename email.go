@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	smtpAddr  = getEnv("SMTP_ADDR", "mailhog:1025")
+	emailFrom = getEnv("EMAIL_FROM", "sample-app@example.com")
+)
+
+// emailFunc sends a message to the comma separated recipients in ?to=
+// through the SMTP server, reporting the server's final response code.
+func emailFunc(c *gin.Context) {
+	var to []string
+	for _, addr := range strings.Split(c.DefaultQuery("to", "demo@example.com"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+
+	code, err := sendEmail(to, "Hello from Go Gin", "This message was sent by the sample app.")
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":      err.Error(),
+			"trace_id":   traceIDFromContext(c.Request.Context()),
+			"recipients": len(to),
+			"smtp_code":  code,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recipients": len(to), "smtp_code": code})
+}
+
+// sendEmail delivers a plain text message and returns the SMTP response
+// code of the last command, or of the command that failed.
+func sendEmail(to []string, subject, body string) (int, error) {
+	cl, err := smtp.Dial(smtpAddr)
+	if err != nil {
+		return 0, err
+	}
+	defer cl.Close()
+
+	if err = cl.Mail(emailFrom); err != nil {
+		return smtpCode(err), err
+	}
+	for _, rcpt := range to {
+		if err = cl.Rcpt(rcpt); err != nil {
+			return smtpCode(err), err
+		}
+	}
+	w, err := cl.Data()
+	if err != nil {
+		return smtpCode(err), err
+	}
+	_, err = fmt.Fprintf(w, "From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n",
+		emailFrom, strings.Join(to, ", "), subject, body)
+	if err != nil {
+		return 0, err
+	}
+	if err = w.Close(); err != nil {
+		return smtpCode(err), err
+	}
+	if err = cl.Quit(); err != nil {
+		return smtpCode(err), err
+	}
+	// the message was accepted with 250 before QUIT
+	return 250, nil
+}
+
+func smtpCode(err error) int {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code
+	}
+	return 0
+}
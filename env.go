@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnv returns the value of the environment variable key, or def if unset.
+func getEnv(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvInt is like getEnv but parses the value as an int.
+func getEnvInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// getEnvFloat is like getEnv but parses the value as a float64.
+func getEnvFloat(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// getEnvDuration is like getEnv but parses the value as a time.Duration.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// getEnvList is like getEnv but splits the value into a comma-separated
+// list, dropping empty items.
+func getEnvList(key, def string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, def), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etagMatchKey marks requests answered with 304 Not Modified.
+const etagMatchKey = "etag.match"
+
+// etagStats counts the ETags computed and the 304s answered.
+var etagStats = expvar.NewMap("etags")
+
+// etagMiddleware adds a weak ETag, a hash of the body, to successful JSON
+// responses to GETs, and answers 304 Not Modified without the body when it
+// matches the request's If-None-Match. The handler still runs: this saves
+// the transfer, not the work, which is what the server-side caches are for.
+// Streamed responses, which flush before they end, go out without an ETag.
+func etagMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		w := &etagWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if !w.buffering {
+			return
+		}
+
+		sum := sha256.Sum256(w.buf.Bytes())
+		etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+		etagStats.Add("computed", 1)
+		w.Header().Set("ETag", etag)
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			etagStats.Add("not_modified", 1)
+			c.Set(etagMatchKey, true)
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			w.ResponseWriter.WriteHeaderNow()
+			return
+		}
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// comparing weakly as RFC 9110 prescribes for GETs.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter holds back a 200 JSON response until it's complete, for
+// etagMiddleware to hash. Other responses pass through.
+type etagWriter struct {
+	gin.ResponseWriter
+	buf       bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		w.buffering = w.Status() == http.StatusOK && mediaType == "application/json"
+	}
+	if w.buffering {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written counts the held back body as written, so that later middlewares
+// don't write another response over it.
+func (w *etagWriter) Written() bool {
+	return w.buffering || w.ResponseWriter.Written()
+}
+
+// Flush gives up on the ETag of a streamed response, sending what's held
+// back.
+func (w *etagWriter) Flush() {
+	if w.buffering {
+		w.buffering = false
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `W/"abc"`
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{"*", true},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`"other", W/"abc"`, true},
+		{`"other"`, false},
+		{`W/"ab"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+	}
+}
+
+func TestEtagWriter(t *testing.T) {
+	handlers := map[string]gin.HandlerFunc{
+		"json": func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"a": 1}) },
+		"text": func(c *gin.Context) { c.String(http.StatusOK, "plain") },
+		"error": func(c *gin.Context) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		},
+		"streamed": func(c *gin.Context) {
+			c.Header("Content-Type", "application/json")
+			_, _ = c.Writer.WriteString(`{"a":`)
+			c.Writer.Flush()
+			_, _ = c.Writer.WriteString(`1}`)
+		},
+	}
+	r := gin.New()
+	r.Use(etagMiddleware())
+	for name, h := range handlers {
+		r.GET("/"+name, h)
+		r.POST("/"+name, h)
+	}
+	get := func(method, path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	jsonETag := get(http.MethodGet, "/json", "").Header().Get("ETag")
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		ifNoneMatch string
+		wantStatus  int
+		wantETag    bool
+		wantBody    string
+	}{
+		{name: "json gets an etag", method: http.MethodGet, path: "/json", wantStatus: http.StatusOK, wantETag: true, wantBody: `{"a":1}`},
+		{name: "matching etag", method: http.MethodGet, path: "/json", ifNoneMatch: jsonETag, wantStatus: http.StatusNotModified, wantETag: true},
+		{name: "stale etag", method: http.MethodGet, path: "/json", ifNoneMatch: `W/"stale"`, wantStatus: http.StatusOK, wantETag: true, wantBody: `{"a":1}`},
+		{name: "not json", method: http.MethodGet, path: "/text", wantStatus: http.StatusOK, wantBody: "plain"},
+		{name: "not 200", method: http.MethodGet, path: "/error", wantStatus: http.StatusNotFound, wantBody: `{"error":"not found"}`},
+		{name: "streamed", method: http.MethodGet, path: "/streamed", wantStatus: http.StatusOK, wantBody: `{"a":1}`},
+		{name: "not a GET", method: http.MethodPost, path: "/json", ifNoneMatch: "*", wantStatus: http.StatusOK, wantBody: `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.method, tt.path, tt.ifNoneMatch)
+			if w.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("ETag") != ""; got != tt.wantETag {
+				t.Errorf("got ETag %q, want one: %v", w.Header().Get("ETag"), tt.wantETag)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("got body %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
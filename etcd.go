@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var etcd *clientv3.Client
+
+// etcdCalls counts the gRPC calls made by the etcd client, per method.
+var etcdCalls = expvar.NewMap("etcd_calls")
+
+func initEtcd(ctx context.Context) error {
+	var err error
+	etcd, err = clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(getEnv("ETCD_ENDPOINTS", "etcd:2379"), ","),
+		DialTimeout: backendTimeouts["etcd"],
+		DialOptions: []grpc.DialOption{grpc.WithChainUnaryInterceptor(etcdInterceptor)},
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, backendTimeouts["etcd"])
+	defer cancel()
+	_, err = etcd.Get(ctx, "health")
+	return err
+}
+
+// etcdInterceptor propagates the request's traceparent to etcd and logs
+// every call with its trace ID.
+func etcdInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if tp := traceparentFromContext(ctx); tp != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "traceparent", tp)
+	}
+	start := clk.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	etcdCalls.Add(method, 1)
+	slog.Debug("etcd call",
+		"trace_id", traceIDFromContext(ctx),
+		"method", method,
+		"duration", clk.Since(start),
+		"error", err,
+	)
+	return err
+}
+
+func etcdGetFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "etcd")
+	defer cancel()
+	resp, err := etcd.Get(ctx, "config/"+c.Param("key"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "etcd get error: %v", err)
+		return
+	}
+	if len(resp.Kvs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	kv := resp.Kvs[0]
+	c.JSON(http.StatusOK, gin.H{
+		"key":      string(kv.Key),
+		"value":    string(kv.Value),
+		"revision": kv.ModRevision,
+	})
+}
+
+func etcdPutFunc(c *gin.Context) {
+	value, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, cancel := backendContext(c.Request.Context(), "etcd")
+	defer cancel()
+	resp, err := etcd.Put(ctx, "config/"+c.Param("key"), string(value))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "etcd put error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revision": resp.Header.Revision})
+}
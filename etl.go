@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+)
+
+// etlStats counts the rows and batches copied by /etl/run, along with the
+// throughput of the last run.
+var etlStats = expvar.NewMap("etl")
+
+// initETL creates the ClickHouse table MySQL orders are copied into. It's
+// a ReplacingMergeTree on the order ID, so copying a row again replaces it.
+func initETL(ctx context.Context) error {
+	return ccn.Exec(ctx, `CREATE TABLE IF NOT EXISTS orders_analytics (
+		id Int64,
+		user_id Int64,
+		amount Float64,
+		created_at DateTime64(3)
+	) ENGINE = ReplacingMergeTree ORDER BY id`)
+}
+
+type etlOrder struct {
+	ID        int64
+	UserID    int64
+	Amount    float64
+	CreatedAt time.Time
+}
+
+// etlRunFunc copies the MySQL orders with IDs above ?after_id= into
+// ClickHouse in batches of ?batch_size= rows.
+func etlRunFunc(c *gin.Context) {
+	batchSize, err := strconv.Atoi(c.DefaultQuery("batch_size", "500"))
+	if err != nil || batchSize < 1 || batchSize > 100_000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch_size must be between 1 and 100000"})
+		return
+	}
+	afterID, err := strconv.ParseInt(c.DefaultQuery("after_id", "0"), 10, 64)
+	if err != nil || afterID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after_id must be a non-negative integer"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	start := clk.Now()
+	var rows, batches int
+	for {
+		batch, err := readOrderBatch(ctx, afterID, batchSize)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Reading MySQL batch %d error: %v", batches+1, err)
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+		batchStart := clk.Now()
+		if err = writeOrderBatch(ctx, batch); err != nil {
+			respondError(c, http.StatusInternalServerError, "Writing ClickHouse batch %d error: %v", batches+1, err)
+			return
+		}
+		batches++
+		rows += len(batch)
+		afterID = batch[len(batch)-1].ID
+		etlStats.Add("rows", int64(len(batch)))
+		etlStats.Add("batches", 1)
+		slog.Debug("etl batch",
+			"trace_id", traceIDFromContext(ctx),
+			"batch", batches,
+			"rows", len(batch),
+			"last_id", afterID,
+			"duration", clk.Since(batchStart),
+		)
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	elapsed := clk.Since(start)
+	rate := new(expvar.Float)
+	rate.Set(float64(rows) / elapsed.Seconds())
+	etlStats.Set("last_rows_per_sec", rate)
+	slog.Info("etl run finished",
+		"trace_id", traceIDFromContext(ctx),
+		"rows", rows,
+		"batches", batches,
+		"duration", elapsed,
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"rows":         rows,
+		"batches":      batches,
+		"last_id":      afterID,
+		"duration_ms":  elapsed.Milliseconds(),
+		"rows_per_sec": rate.Value(),
+	})
+}
+
+// readOrderBatch reads up to n orders with IDs above afterID, in ID order.
+func readOrderBatch(ctx context.Context, afterID int64, n int) ([]etlOrder, error) {
+	ctx, cancel := backendContext(ctx, "mysql")
+	defer cancel()
+
+	rows, err := mysqldb.QueryContext(ctx,
+		commented(ctx, "SELECT id, user_id, amount, created_at FROM orders WHERE id > ? ORDER BY id LIMIT ?"), afterID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []etlOrder
+	for rows.Next() {
+		var o etlOrder
+		if err = rows.Scan(&o.ID, &o.UserID, &o.Amount, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		batch = append(batch, o)
+	}
+	return batch, rows.Err()
+}
+
+func writeOrderBatch(ctx context.Context, batch []etlOrder) error {
+	ctx, cancel := backendContext(ctx, "clickhouse")
+	defer cancel()
+
+	return clickhouseWriters.Do(ctx, func(ctx context.Context, _ string, conn driver.Conn) error {
+		b, err := conn.PrepareBatch(ctx, "INSERT INTO orders_analytics")
+		if err != nil {
+			return err
+		}
+		for _, o := range batch {
+			if err = b.Append(o.ID, o.UserID, o.Amount, o.CreatedAt); err != nil {
+				_ = b.Abort()
+				return err
+			}
+		}
+		return b.Send()
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// event is a notable occurrence worth showing on the incident timeline.
+type event struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// eventLog is a fixed-size ring buffer of the most recent events.
+type eventLog struct {
+	mu     sync.Mutex
+	buf    []event
+	next   int
+	filled bool
+	// total is the number of events ever added.
+	total int64
+}
+
+var events = newEventLog(getEnvInt("EVENT_LOG_SIZE", 200))
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{buf: make([]event, max(size, 1))}
+}
+
+// recordEvent adds an event to the timeline and logs it, attributing it to
+// the trace and request ctx belongs to, if any.
+func recordEvent(ctx context.Context, kind, format string, args ...any) {
+	e := event{
+		Time:      clk.Now().UTC(),
+		Kind:      kind,
+		Message:   fmt.Sprintf(format, args...),
+		TraceID:   traceIDFromContext(ctx),
+		RequestID: requestIDFromContext(ctx),
+	}
+	slog.Info("event", "kind", e.Kind, "message", e.Message, "trace_id", e.TraceID, "request_id", e.RequestID)
+	events.add(e)
+}
+
+func (l *eventLog) add(e event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf[l.next] = e
+	l.next = (l.next + 1) % len(l.buf)
+	if l.next == 0 {
+		l.filled = true
+	}
+	l.total++
+}
+
+// since returns the events still in the buffer that were added after the
+// first n, from oldest to newest, and the number of events added so far
+// to pass to the next call.
+func (l *eventLog) since(n int64) ([]event, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	count := int(min(max(l.total-n, 0), int64(len(l.buf))))
+	out := make([]event, 0, count)
+	for i := count; i >= 1; i-- {
+		out = append(out, l.buf[(l.next-i+len(l.buf))%len(l.buf)])
+	}
+	return out, l.total
+}
+
+// list returns the events from newest to oldest.
+func (l *eventLog) list() []event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.filled {
+		n = len(l.buf)
+	}
+	out := make([]event, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.buf[(l.next-i+len(l.buf))%len(l.buf)])
+	}
+	return out
+}
+
+func debugEventsFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"events": events.list()})
+}
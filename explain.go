@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// slowQueryThreshold is the duration above which a MySQL query gets its
+	// plan captured.
+	slowQueryThreshold = getEnvDuration("MYSQL_SLOW_QUERY", 200*time.Millisecond)
+
+	// explainSlots bounds how many EXPLAINs run at once; slow queries
+	// finding no free slot go without a plan.
+	explainSlots = make(chan struct{}, 2)
+
+	// explainedAt throttles plan captures to one per query per minute.
+	explainedAt sync.Map
+
+	slowQueries     = expvar.NewInt("mysql_slow_queries")
+	explainsSkipped = expvar.NewInt("mysql_explains_skipped")
+)
+
+// explainIfSlow logs a query that took longer than slowQueryThreshold since
+// start, along with a summary of its plan obtained in the background.
+func explainIfSlow(ctx context.Context, db *sql.DB, query string, start time.Time, args ...any) {
+	elapsed := clk.Since(start)
+	if elapsed < slowQueryThreshold {
+		return
+	}
+	slowQueries.Add(1)
+	traceID := traceIDFromContext(ctx)
+
+	stmt := strings.TrimSpace(query)
+	// throttle on the statement without its per-request comment
+	key := stmtWithoutComment(stmt)
+	if !strings.HasPrefix(strings.ToUpper(key), "SELECT") {
+		slog.Warn("slow query", "trace_id", traceID, "query", stmt, "duration", elapsed)
+		return
+	}
+	if last, ok := explainedAt.Load(key); ok && clk.Since(last.(time.Time)) < time.Minute {
+		slog.Warn("slow query", "trace_id", traceID, "query", stmt, "duration", elapsed)
+		return
+	}
+	select {
+	case explainSlots <- struct{}{}:
+	default:
+		explainsSkipped.Add(1)
+		slog.Warn("slow query", "trace_id", traceID, "query", stmt, "duration", elapsed)
+		return
+	}
+	explainedAt.Store(key, clk.Now())
+
+	go func() {
+		defer func() { <-explainSlots }()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		plan, err := explain(ctx, db, stmt, args...)
+		if err != nil {
+			slog.Warn("slow query", "trace_id", traceID, "query", stmt, "duration", elapsed, "explain_error", err)
+			return
+		}
+		slog.Warn("slow query", "trace_id", traceID, "query", stmt, "duration", elapsed, "plan", plan)
+	}()
+}
+
+// stmtWithoutComment strips a leading /*...*/ comment, such as the one
+// added by commented.
+func stmtWithoutComment(stmt string) string {
+	if rest, ok := strings.CutPrefix(stmt, "/*"); ok {
+		if _, after, ok := strings.Cut(rest, "*/"); ok {
+			return strings.TrimSpace(after)
+		}
+	}
+	return stmt
+}
+
+// explain summarizes the plan of query as one "table type key rows extra"
+// entry per plan row.
+func explain(ctx context.Context, db *sql.DB, query string, args ...any) (string, error) {
+	rows, err := db.QueryContext(ctx, "EXPLAIN "+query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	var steps []string
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		dest := make([]any, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return "", err
+		}
+		row := map[string]string{}
+		for i, col := range cols {
+			row[strings.ToLower(col)] = values[i].String
+		}
+		steps = append(steps, fmt.Sprintf("table=%s type=%s key=%s rows=%s extra=%q",
+			row["table"], row["type"], row["key"], row["rows"], row["extra"]))
+	}
+	return strings.Join(steps, "; "), rows.Err()
+}
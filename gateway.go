@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newRPCGateway returns a grpc-gateway mux translating REST/JSON calls
+// under /rpc into calls of the Demo gRPC service:
+//
+//	GET  /rpc/v1/echo/{message}  Echo
+//	POST /rpc/v1/echo            Echo, with a JSON string body
+//	GET  /rpc/v1/events          WatchEvents, as newline-delimited JSON
+//
+// The handlers do what protoc-gen-grpc-gateway would generate. The calls
+// go through grpcConn with the HTTP request's context, so the gRPC server
+// continues the trace of the HTTP request.
+func newRPCGateway() (*runtime.ServeMux, error) {
+	mux := runtime.NewServeMux()
+
+	echo := func(w http.ResponseWriter, r *http.Request, pattern string, in *wrapperspb.StringValue) {
+		ctx, outbound, ok := gatewayContext(mux, w, r, "Echo", pattern)
+		if !ok {
+			return
+		}
+		var md runtime.ServerMetadata
+		out := new(wrapperspb.StringValue)
+		err := grpcConn.Invoke(ctx, "/"+demoServiceName+"/Echo", in, out,
+			grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, out)
+	}
+
+	err := mux.HandlePath(http.MethodGet, "/rpc/v1/echo/{message}", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		echo(w, r, "/rpc/v1/echo/{message}", wrapperspb.String(params["message"]))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = mux.HandlePath(http.MethodPost, "/rpc/v1/echo", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		in := new(wrapperspb.StringValue)
+		if err := inbound.NewDecoder(r.Body).Decode(in); err != nil {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+		echo(w, r, "/rpc/v1/echo", in)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = mux.HandlePath(http.MethodGet, "/rpc/v1/events", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx, outbound, ok := gatewayContext(mux, w, r, "WatchEvents", "/rpc/v1/events")
+		if !ok {
+			return
+		}
+		cs, err := grpcConn.NewStream(ctx, &demoServiceDesc.Streams[0], "/"+demoServiceName+"/WatchEvents")
+		if err == nil {
+			err = cs.SendMsg(&emptypb.Empty{})
+		}
+		if err == nil {
+			err = cs.CloseSend()
+		}
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		header, err := cs.Header()
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, err)
+			return
+		}
+		ctx = runtime.NewServerMetadataContext(ctx, runtime.ServerMetadata{HeaderMD: header})
+		runtime.ForwardResponseStream(ctx, mux, outbound, w, r, func() (proto.Message, error) {
+			msg := new(structpb.Struct)
+			err := cs.RecvMsg(msg)
+			return msg, err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// gatewayContext prepares the context of a call of method, turning
+// Grpc-Metadata-* request headers into gRPC metadata. It writes the error
+// response itself when it fails.
+func gatewayContext(mux *runtime.ServeMux, w http.ResponseWriter, r *http.Request, method, pattern string) (context.Context, runtime.Marshaler, bool) {
+	_, outbound := runtime.MarshalerForRequest(mux, r)
+	ctx, err := runtime.AnnotateContext(r.Context(), mux, r, "/"+demoServiceName+"/"+method, runtime.WithHTTPPathPattern(pattern))
+	if err != nil {
+		runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+		return nil, nil, false
+	}
+	return ctx, outbound, true
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The Demo gRPC service is served on GRPC_ADDR next to the HTTP server. Its
+// messages are protobuf well-known types, so it does without generated
+// code:
+//
+//	service Demo {
+//	  rpc Echo(google.protobuf.StringValue) returns (google.protobuf.StringValue);
+//	  rpc WatchEvents(google.protobuf.Empty) returns (stream google.protobuf.Struct);
+//	  rpc Upload(stream google.protobuf.BytesValue) returns (google.protobuf.Struct);
+//	}
+const demoServiceName = "sample.v1.Demo"
+
+var grpcAddr = getEnv("GRPC_ADDR", ":9090")
+
+var (
+	// grpcConn is a client of our own gRPC server, used by the /grpc
+	// endpoints.
+	grpcConn *grpc.ClientConn
+
+	// grpcServerCalls counts the calls handled by the gRPC server, per
+	// method.
+	grpcServerCalls = expvar.NewMap("grpc_server_calls")
+
+	// grpcHealth answers grpc.health.v1 checks, e.g. from Kubernetes gRPC
+	// probes. It reports NOT_SERVING until warm-up has completed.
+	grpcHealth = health.NewServer()
+
+	// grpcUntracedServices are left out of the call logs and metrics, so
+	// that frequent health probes and grpcurl sessions don't drown out
+	// real traffic.
+	grpcUntracedServices = strings.Split(getEnv("GRPC_UNTRACED_SERVICES",
+		"grpc.health.v1.Health,grpc.reflection.v1.ServerReflection,grpc.reflection.v1alpha.ServerReflection"), ",")
+)
+
+type demoService interface {
+	Echo(ctx context.Context, in *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+	WatchEvents(in *emptypb.Empty, stream grpc.ServerStreamingServer[structpb.Struct]) error
+	Upload(stream grpc.ClientStreamingServer[wrapperspb.BytesValue, structpb.Struct]) error
+}
+
+var demoServiceDesc = grpc.ServiceDesc{
+	ServiceName: demoServiceName,
+	HandlerType: (*demoService)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Echo", Handler: demoEchoHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "WatchEvents", Handler: demoWatchEventsHandler, ServerStreams: true},
+		{StreamName: "Upload", Handler: demoUploadHandler, ClientStreams: true},
+	},
+	Metadata: "sample/v1/demo.proto",
+}
+
+// init registers the descriptor of the Demo service, which generated code
+// would otherwise have done, so that reflection clients such as grpcurl can
+// describe and call it.
+func init() {
+	methods := []*descriptorpb.MethodDescriptorProto{
+		{Name: proto.String("Echo"), InputType: proto.String(".google.protobuf.StringValue"), OutputType: proto.String(".google.protobuf.StringValue")},
+		{Name: proto.String("WatchEvents"), InputType: proto.String(".google.protobuf.Empty"), OutputType: proto.String(".google.protobuf.Struct"), ServerStreaming: proto.Bool(true)},
+		{Name: proto.String("Upload"), InputType: proto.String(".google.protobuf.BytesValue"), OutputType: proto.String(".google.protobuf.Struct"), ClientStreaming: proto.Bool(true)},
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String(demoServiceDesc.Metadata.(string)),
+		Package:    proto.String(strings.TrimSuffix(demoServiceName, ".Demo")),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/empty.proto", "google/protobuf/struct.proto", "google/protobuf/wrappers.proto"},
+		Service:    []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Demo"), Method: methods}},
+	}, protoregistry.GlobalFiles)
+	if err == nil {
+		err = protoregistry.GlobalFiles.RegisterFile(fd)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func demoEchoHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(demoService).Echo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + demoServiceName + "/Echo"}
+	return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+		return srv.(demoService).Echo(ctx, req.(*wrapperspb.StringValue))
+	})
+}
+
+func demoWatchEventsHandler(srv any, stream grpc.ServerStream) error {
+	in := new(emptypb.Empty)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(demoService).WatchEvents(in, &grpc.GenericServerStream[emptypb.Empty, structpb.Struct]{ServerStream: stream})
+}
+
+func demoUploadHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(demoService).Upload(&grpc.GenericServerStream[wrapperspb.BytesValue, structpb.Struct]{ServerStream: stream})
+}
+
+type demoServer struct{}
+
+func (demoServer) Echo(_ context.Context, in *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	return wrapperspb.String(in.GetValue()), nil
+}
+
+// WatchEvents streams the events on the timeline, then every new one until
+// the client goes away.
+func (demoServer) WatchEvents(_ *emptypb.Empty, stream grpc.ServerStreamingServer[structpb.Struct]) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	var seen int64
+	for {
+		var evs []event
+		evs, seen = events.since(seen)
+		for _, e := range evs {
+			msg, err := structpb.NewStruct(map[string]any{
+				"time":     e.Time.Format(time.RFC3339Nano),
+				"kind":     e.Kind,
+				"message":  e.Message,
+				"trace_id": e.TraceID,
+			})
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			if err = stream.Send(msg); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Upload stores the streamed chunks in the upload store under the name in
+// the upload-name metadata.
+func (demoServer) Upload(stream grpc.ClientStreamingServer[wrapperspb.BytesValue, structpb.Struct]) error {
+	ctx := stream.Context()
+	name := "grpc-upload-" + randomHex(4)
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("upload-name")) > 0 {
+		name = filepath.Base(md.Get("upload-name")[0])
+	}
+
+	pr, pw := io.Pipe()
+	type result struct {
+		size int64
+		err  error
+	}
+	stored := make(chan result, 1)
+	go func() {
+		size, err := uploadStore.Put(ctx, name, pr)
+		_ = pr.CloseWithError(err)
+		stored <- result{size, err}
+	}()
+
+	chunks := 0
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			_ = pw.Close()
+			break
+		}
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			<-stored
+			return err
+		}
+		chunks++
+		if _, err = pw.Write(chunk.GetValue()); err != nil {
+			// the store gave up; its error is reported below
+			break
+		}
+	}
+	res := <-stored
+	if res.err != nil {
+		return status.Errorf(codes.Internal, "storing upload: %v", res.err)
+	}
+	reply, err := structpb.NewStruct(map[string]any{
+		"name":   name,
+		"size":   res.size,
+		"chunks": chunks,
+	})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.SendAndClose(reply)
+}
+
+// grpcServerContext continues the trace of the caller's traceparent
+// metadata, or starts a new one, and keeps the caller's request ID and
+// tenant.
+func grpcServerContext(ctx context.Context) context.Context {
+	var traceID string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if tp := md.Get("traceparent"); len(tp) > 0 {
+		traceID = parseTraceparent(tp[0])
+	}
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+	ctx = context.WithValue(ctx, traceIDKey{}, traceID)
+	if id := md.Get(requestIDHeader); len(id) > 0 && validRequestID(id[0]) {
+		ctx = context.WithValue(ctx, requestIDKey{}, id[0])
+	}
+	if b := md.Get("baggage"); len(b) > 0 {
+		if tenant := tenantFromBaggage(b[0]); slices.Contains(tenants, tenant) {
+			ctx = context.WithValue(ctx, tenantKey{}, tenant)
+		}
+	}
+	return ctx
+}
+
+// grpcTraced reports whether calls of method are logged and counted.
+func grpcTraced(method string) bool {
+	for _, svc := range grpcUntracedServices {
+		if strings.HasPrefix(method, "/"+svc+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+func grpcUnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !grpcTraced(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx = grpcServerContext(ctx)
+	start := clk.Now()
+	resp, err := handler(ctx, req)
+	logGRPCCall(ctx, info.FullMethod, start, 1, 1, err)
+	return resp, err
+}
+
+func grpcStreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !grpcTraced(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ts := &tracedServerStream{ServerStream: ss, ctx: grpcServerContext(ss.Context())}
+	start := clk.Now()
+	err := handler(srv, ts)
+	logGRPCCall(ts.ctx, info.FullMethod, start, ts.received, ts.sent, err)
+	return err
+}
+
+// tracedServerStream carries the trace of the call in its context and
+// counts the messages going each way.
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx            context.Context
+	sent, received int
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *tracedServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
+
+func (s *tracedServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+	}
+	return err
+}
+
+func logGRPCCall(ctx context.Context, method string, start time.Time, received, sent int, err error) {
+	grpcServerCalls.Add(method, 1)
+	slog.Debug("grpc call",
+		"trace_id", traceIDFromContext(ctx),
+		"request_id", requestIDFromContext(ctx),
+		"tenant", tenantFromContext(ctx),
+		"method", method,
+		"code", status.Code(err).String(),
+		"received", received,
+		"sent", sent,
+		"duration", clk.Since(start),
+	)
+}
+
+// grpcUnaryClientInterceptor and grpcStreamClientInterceptor propagate the
+// request's traceparent, request ID and tenant baggage to the server.
+func grpcUnaryClientInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx = grpcOutgoingContext(ctx)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func grpcStreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx = grpcOutgoingContext(ctx)
+	return streamer(ctx, desc, cc, method, opts...)
+}
+
+func grpcOutgoingContext(ctx context.Context) context.Context {
+	if tp := traceparentFromContext(ctx); tp != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "traceparent", tp)
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestIDHeader, id)
+	}
+	if b := baggageFromContext(ctx); b != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "baggage", b)
+	}
+	return ctx
+}
+
+// serveGRPC starts the gRPC server on GRPC_ADDR, along with the health and
+// reflection services, and connects grpcConn to it.
+func serveGRPC(upg *upgrader) (*grpc.Server, error) {
+	ln, err := upg.Listen("tcp", grpcAddr)
+	if err != nil {
+		return nil, err
+	}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcUnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(grpcStreamServerInterceptor),
+	)
+	srv.RegisterService(&demoServiceDesc, demoServer{})
+	healthpb.RegisterHealthServer(srv, grpcHealth)
+	reflection.Register(srv)
+	setGRPCServing(false)
+
+	_, port, err := net.SplitHostPort(grpcAddr)
+	if err != nil {
+		return nil, err
+	}
+	grpcConn, err = grpc.NewClient("localhost:"+port,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(grpcUnaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(grpcStreamClientInterceptor),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		slog.Info("grpc server started", "addr", grpcAddr)
+		if err := srv.Serve(ln); err != nil {
+			slog.Error("grpc server failed", "error", err)
+		}
+	}()
+	return srv, nil
+}
+
+// setGRPCServing sets the health status of the server as a whole and of
+// the Demo service.
+func setGRPCServing(serving bool) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	grpcHealth.SetServingStatus("", st)
+	grpcHealth.SetServingStatus(demoServiceName, st)
+}
+
+// stopGRPC lets the calls in flight finish, cutting off streams still open
+// after five seconds. Health watchers are told NOT_SERVING first.
+func stopGRPC(srv *grpc.Server) {
+	grpcHealth.Shutdown()
+	_ = grpcConn.Close()
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		srv.Stop()
+	}
+}
+
+// grpcEchoFunc makes a unary call.
+func grpcEchoFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "grpc")
+	defer cancel()
+
+	out := new(wrapperspb.StringValue)
+	err := grpcConn.Invoke(ctx, "/"+demoServiceName+"/Echo", wrapperspb.String(c.DefaultQuery("message", "hello")), out)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "gRPC error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": out.GetValue()})
+}
+
+// grpcEventsFunc reads up to ?n= events from the WatchEvents server stream,
+// waiting at most ?timeout_ms= for them.
+func grpcEventsFunc(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "10"))
+	if err != nil || n < 1 || n > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "n must be between 1 and 1000"})
+		return
+	}
+	timeoutMs, err := strconv.Atoi(c.DefaultQuery("timeout_ms", "2000"))
+	if err != nil || timeoutMs < 1 || timeoutMs > 60_000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout_ms must be between 1 and 60000"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+
+	cs, err := grpcConn.NewStream(ctx, &demoServiceDesc.Streams[0], "/"+demoServiceName+"/WatchEvents")
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "gRPC error: %v", err)
+		return
+	}
+	stream := &grpc.GenericClientStream[emptypb.Empty, structpb.Struct]{ClientStream: cs}
+	if err = stream.Send(&emptypb.Empty{}); err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "gRPC error: %v", err)
+		return
+	}
+
+	received := []map[string]any{}
+	for len(received) < n {
+		msg, err := stream.Recv()
+		if status.Code(err) == codes.DeadlineExceeded {
+			break
+		}
+		if err != nil {
+			respondError(c, http.StatusBadGateway, "gRPC error: %v", err)
+			return
+		}
+		received = append(received, msg.AsMap())
+	}
+	c.JSON(http.StatusOK, gin.H{"events": received})
+}
+
+// grpcUploadFunc streams ?chunks= chunks of ?chunk_kb= kilobytes to Upload.
+func grpcUploadFunc(c *gin.Context) {
+	chunks, err := strconv.Atoi(c.DefaultQuery("chunks", "8"))
+	if err != nil || chunks < 1 || chunks > 10_000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chunks must be between 1 and 10000"})
+		return
+	}
+	chunkKB, err := strconv.Atoi(c.DefaultQuery("chunk_kb", "16"))
+	if err != nil || chunkKB < 1 || chunkKB*1024 > len(payloadChunk) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chunk_kb must be between 1 and " + strconv.Itoa(len(payloadChunk)/1024)})
+		return
+	}
+	ctx, cancel := backendContext(c.Request.Context(), "grpc")
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "upload-name", c.DefaultQuery("name", "grpc-demo.bin"))
+
+	cs, err := grpcConn.NewStream(ctx, &demoServiceDesc.Streams[1], "/"+demoServiceName+"/Upload")
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "gRPC error: %v", err)
+		return
+	}
+	stream := &grpc.GenericClientStream[wrapperspb.BytesValue, structpb.Struct]{ClientStream: cs}
+	chunk := wrapperspb.Bytes(payloadChunk[:chunkKB*1024])
+	for range chunks {
+		// on failure, Send returns io.EOF and CloseAndRecv the actual error
+		if err = stream.Send(chunk); err != nil {
+			break
+		}
+	}
+	reply, err := stream.CloseAndRecv()
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "gRPC error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, reply.AsMap())
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// hashRing places keys on nodes with consistent hashing. Each node is
+// hashed onto the ring replicas times to even out the distribution, so
+// adding or removing a node only moves about 1/n of the keys.
+type hashRing struct {
+	replicas int
+	nodes    []string
+	hashes   []uint32
+	owners   map[uint32]string
+}
+
+func newHashRing(nodes []string, replicas int) *hashRing {
+	r := &hashRing{
+		replicas: replicas,
+		nodes:    nodes,
+		owners:   make(map[uint32]string, len(nodes)*replicas),
+	}
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(i)))
+			r.hashes = append(r.hashes, h)
+			r.owners[h] = node
+		}
+	}
+	slices.Sort(r.hashes)
+	return r
+}
+
+// Node returns the node owning key, or "" if the ring is empty.
+func (r *hashRing) Node(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// Without returns a copy of the ring with node removed.
+func (r *hashRing) Without(node string) *hashRing {
+	nodes := slices.DeleteFunc(slices.Clone(r.nodes), func(n string) bool { return n == node })
+	return newHashRing(nodes, r.replicas)
+}
+
+var (
+	ring        *hashRing
+	ringClients map[string]*redis.Client
+)
+
+// initHashRing connects to every Redis instance listed in REDIS_ADDRS.
+func initHashRing(ctx context.Context) error {
+	addrs := strings.Split(getEnv("REDIS_ADDRS", "redis:6379"), ",")
+	ringClients = make(map[string]*redis.Client, len(addrs))
+	for i, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		addrs[i] = addr
+		ringClients[addr] = redis.NewClient(&redis.Options{Addr: addr})
+		if err := ringClients[addr].Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("%s: %w", addr, err)
+		}
+	}
+	ring = newHashRing(addrs, getEnvInt("HASHRING_REPLICAS", 100))
+	return nil
+}
+
+// hashringFunc increments a counter for the key on the node owning it.
+// With ?without=<node>, it also simulates removing that node and reports
+// where the key would move and what share of keys would be rebalanced.
+func hashringFunc(c *gin.Context) {
+	key := c.Param("key")
+	node := ring.Node(key)
+	c.Header("X-Redis-Node", node)
+
+	hits, err := ringClients[node].Incr(c.Request.Context(), "hashring:"+key).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis error on %s: %v", node, err)
+		return
+	}
+	res := gin.H{"key": key, "node": node, "hits": hits, "nodes": ring.nodes}
+
+	if without := c.Query("without"); without != "" {
+		smaller := ring.Without(without)
+		moved := 0
+		const sample = 10000
+		for i := 0; i < sample; i++ {
+			k := "key-" + strconv.Itoa(i)
+			if ring.Node(k) != smaller.Node(k) {
+				moved++
+			}
+		}
+		res["rebalance"] = gin.H{
+			"removed":   without,
+			"node":      smaller.Node(key),
+			"moved_pct": float64(moved) * 100 / sample,
+		}
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashRingNode(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []string
+	}{
+		{name: "empty", nodes: nil},
+		{name: "single node", nodes: []string{"a:6379"}},
+		{name: "three nodes", nodes: []string{"a:6379", "b:6379", "c:6379"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newHashRing(tt.nodes, 100)
+			counts := map[string]int{}
+			for i := 0; i < 3000; i++ {
+				key := "key" + strconv.Itoa(i)
+				node := r.Node(key)
+				if node != r.Node(key) {
+					t.Fatalf("%s: placement isn't stable", key)
+				}
+				counts[node]++
+			}
+			if len(tt.nodes) == 0 {
+				if counts[""] != 3000 {
+					t.Fatalf("empty ring placed keys on %v", counts)
+				}
+				return
+			}
+			for _, node := range tt.nodes {
+				// replicas even out the distribution
+				if share := float64(counts[node]) / 3000; share < 0.5/float64(len(tt.nodes)) {
+					t.Errorf("node %s got %.0f%% of the keys", node, share*100)
+				}
+			}
+		})
+	}
+}
+
+func TestHashRingWithout(t *testing.T) {
+	nodes := []string{"a:6379", "b:6379", "c:6379", "d:6379"}
+	r := newHashRing(nodes, 100)
+	for _, removed := range nodes {
+		t.Run(removed, func(t *testing.T) {
+			without := r.Without(removed)
+			moved := 0
+			for i := 0; i < 4000; i++ {
+				key := "key" + strconv.Itoa(i)
+				before, after := r.Node(key), without.Node(key)
+				switch {
+				case after == removed:
+					t.Fatalf("%s: still placed on the removed node", key)
+				case before != removed && before != after:
+					t.Fatalf("%s: moved from %s to %s, though its node stayed", key, before, after)
+				case before == removed:
+					moved++
+				}
+			}
+			if moved == 0 || moved > 2000 {
+				t.Errorf("%d of 4000 keys moved, want about 1/4", moved)
+			}
+			if len(r.nodes) != len(nodes) {
+				t.Errorf("the original ring lost a node")
+			}
+		})
+	}
+}
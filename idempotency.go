@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+
+	// idempotentReplayKey marks requests answered with a stored response.
+	idempotentReplayKey = "idempotent.replay"
+
+	// idempotencyLockTTL bounds how long a crashed request keeps its key
+	// locked.
+	idempotencyLockTTL = time.Minute
+)
+
+var (
+	idempotencyTTL            = getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	idempotencyMaxBody        = getEnvInt("IDEMPOTENCY_MAX_BODY", 1<<20)
+	idempotencyMaxRequestBody = getEnvInt("IDEMPOTENCY_MAX_REQUEST_BODY", 1<<20)
+
+	// idempotencyStats counts stored responses, replays, and requests
+	// rejected for reusing a key in flight or with a different body.
+	idempotencyStats = expvar.NewMap("idempotency")
+)
+
+// storedResponse is the response to a POST with an Idempotency-Key, kept
+// in Redis along with the fingerprint of the request it answered.
+type storedResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// idempotencyMiddleware makes POSTs carrying an Idempotency-Key header safe
+// to retry: the first request's response is stored in Redis for
+// IDEMPOTENCY_TTL and replayed, with an Idempotent-Replayed header, to
+// later requests with the same key and body. Keys are scoped to the API key
+// and tenant. Reusing a key for a different request is rejected with 422,
+// and reusing it while the first request is still running with 409.
+// Server errors aren't stored, so that they can be retried, nor are
+// responses over IDEMPOTENCY_MAX_BODY bytes. The request body is read whole
+// to fingerprint it, so bodies over IDEMPOTENCY_MAX_REQUEST_BODY bytes are
+// rejected with 413. If Redis is unavailable, requests go through without
+// the guarantee.
+func idempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if c.Request.Method != http.MethodPost || key == "" || !stepAvailable("redis") {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": idempotencyHeader + " must be at most 255 characters"})
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, int64(idempotencyMaxRequestBody)))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, "Request body over %d bytes", tooLarge.Limit)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Request body error: %v", err)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(append([]byte(c.Request.URL.RequestURI()+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+		redisKey := "idempotency:" + tenantFromContext(c.Request.Context()) + ":" + c.GetString(apiKeyNameKey) + ":" + key
+
+		ctx, cancel := backendContext(c.Request.Context(), "redis")
+		locked, err := rdb.SetNX(ctx, redisKey, "", idempotencyLockTTL).Result()
+		var raw []byte
+		if err == nil && !locked {
+			raw, err = rdb.Get(ctx, redisKey).Bytes()
+			if errors.Is(err, redis.Nil) {
+				// expired in between, handle the request as a new one
+				locked, err = true, nil
+			}
+		}
+		cancel()
+		if err != nil {
+			slog.Warn("idempotency check failed", "trace_id", traceIDFromContext(c.Request.Context()), "error", err)
+			c.Next()
+			return
+		}
+
+		if !locked {
+			if len(raw) == 0 {
+				idempotencyStats.Add("in_flight", 1)
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this " + idempotencyHeader + " is in progress"})
+				return
+			}
+			var stored storedResponse
+			if err = json.Unmarshal(raw, &stored); err != nil {
+				respondError(c, http.StatusInternalServerError, "Stored response error: %v", err)
+				c.Abort()
+				return
+			}
+			if stored.Fingerprint != fingerprint {
+				idempotencyStats.Add("mismatches", 1)
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": idempotencyHeader + " was used for a different request"})
+				return
+			}
+			idempotencyStats.Add("replays", 1)
+			c.Set(idempotentReplayKey, true)
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.Status, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		w := &capturingWriter{ResponseWriter: c.Writer, limit: idempotencyMaxBody}
+		c.Writer = w
+		c.Next()
+
+		ctx, cancel = backendContext(context.WithoutCancel(c.Request.Context()), "redis")
+		defer cancel()
+		status := w.Status()
+		if status >= http.StatusInternalServerError || w.truncated {
+			err = rdb.Del(ctx, redisKey).Err()
+		} else {
+			raw, _ = json.Marshal(storedResponse{
+				Fingerprint: fingerprint,
+				Status:      status,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        w.body.Bytes(),
+			})
+			err = rdb.Set(ctx, redisKey, raw, idempotencyTTL).Err()
+			idempotencyStats.Add("stored", 1)
+		}
+		if err != nil {
+			slog.Warn("idempotency store failed", "trace_id", traceIDFromContext(c.Request.Context()), "error", err)
+		}
+	}
+}
+
+// capturingWriter keeps a copy of the first limit bytes of the response
+// body, noting whether there were more.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *capturingWriter) capture(b []byte) {
+	if room := w.limit - w.body.Len(); len(b) > room {
+		w.body.Write(b[:max(room, 0)])
+		w.truncated = true
+		return
+	}
+	w.body.Write(b)
+}
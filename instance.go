@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// instanceID identifies this process among horizontally scaled instances.
+var instanceID = newInstanceID()
+
+var instanceStarted = clk.Now()
+
+// heartbeatInterval is how often the instance registers itself in Redis.
+// Instances missing three heartbeats are dropped from the cluster.
+var heartbeatInterval = getEnvDuration("HEARTBEAT_INTERVAL", 10*time.Second)
+
+var (
+	heartbeats      = expvar.NewInt("heartbeats")
+	heartbeatErrors = expvar.NewInt("heartbeat_errors")
+)
+
+const (
+	instancesKey    = "cluster:instances"
+	instanceInfoKey = "cluster:instance_info"
+)
+
+func init() {
+	expvar.NewString("instance").Set(instanceID)
+	expvar.Publish("uptime", expvar.Func(func() any {
+		return clk.Since(instanceStarted).Seconds()
+	}))
+}
+
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "-" + randomHex(3)
+}
+
+// identityMiddleware tags every response with the instance and its region.
+func identityMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Instance-Id", instanceID)
+		if region != "" {
+			c.Header("X-Region", region)
+		}
+		c.Next()
+	}
+}
+
+// runHeartbeat registers the instance in Redis every heartbeatInterval
+// until ctx is done, then deregisters it.
+func runHeartbeat(ctx context.Context) {
+	if !stepAvailable("redis") {
+		return
+	}
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if err := heartbeat(ctx); err != nil {
+			heartbeatErrors.Add(1)
+			slog.Warn("heartbeat failed", "error", err)
+		} else {
+			heartbeats.Add(1)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), backendTimeouts["redis"])
+			defer cancel()
+			_, _ = rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				p.ZRem(ctx, instancesKey, instanceID)
+				p.HDel(ctx, instanceInfoKey, instanceID)
+				return nil
+			})
+			return
+		}
+	}
+}
+
+func heartbeat(ctx context.Context) error {
+	ctx, cancel := backendContext(ctx, "redis")
+	defer cancel()
+	_, err := rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, instancesKey, redis.Z{Score: float64(clk.Now().Unix()), Member: instanceID})
+		p.HSet(ctx, instanceInfoKey, instanceID, region)
+		return nil
+	})
+	return err
+}
+
+// clusterFunc lists the instances that sent a heartbeat recently, dropping
+// those that stopped.
+func clusterFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "redis")
+	defer cancel()
+
+	cutoff := clk.Now().Add(-3 * heartbeatInterval).Unix()
+	stale, err := rdb.ZRangeByScore(ctx, instancesKey, &redis.ZRangeBy{Min: "-inf", Max: "(" + strconv.FormatInt(cutoff, 10)}).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis error: %v", err)
+		return
+	}
+	if len(stale) > 0 {
+		rdb.ZRem(ctx, instancesKey, stale)
+		rdb.HDel(ctx, instanceInfoKey, stale...)
+	}
+
+	live, err := rdb.ZRangeByScoreWithScores(ctx, instancesKey, &redis.ZRangeBy{Min: strconv.FormatInt(cutoff, 10), Max: "+inf"}).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis error: %v", err)
+		return
+	}
+	regions, err := rdb.HGetAll(ctx, instanceInfoKey).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis error: %v", err)
+		return
+	}
+	instances := make([]gin.H, 0, len(live))
+	for _, z := range live {
+		id := z.Member.(string)
+		instances = append(instances, gin.H{
+			"id":        id,
+			"region":    regions[id],
+			"last_seen": time.Unix(int64(z.Score), 0).UTC(),
+			"self":      id == instanceID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"instances": instances})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// The job queue is a Redis list: handlers LPUSH jobs, and workers move them
+// to the processing list with BLMOVE while they run, so that a job being
+// worked on isn't lost from Redis if its worker's request to finish it
+// fails. The keys share a hash tag to stay in one slot in cluster mode.
+const (
+	jobQueueKey      = "{jobs}:queue"
+	jobProcessingKey = "{jobs}:processing"
+	jobDeadKey       = "{jobs}:dead"
+	jobStatusPrefix  = "{jobs}:status:"
+
+	// jobMaxAttempts is how often a job is attempted before it is moved to
+	// the dead list.
+	jobMaxAttempts = 3
+)
+
+var errJobFailed = errors.New("job failed on request")
+
+// jobStats counts jobs by what happened to them: enqueued, processed,
+// retried and dead. queue_depth is the queue's length as last seen by a
+// worker.
+var jobStats = expvar.NewMap("jobs")
+
+// job is a unit of deferred work. Traceparent ties its processing back to
+// the request that enqueued it.
+type job struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	DurationMs  int       `json:"duration_ms,omitempty"`
+	Attempts    int       `json:"attempts"`
+	Traceparent string    `json:"traceparent"`
+	EnqueuedAt  time.Time `json:"enqueued_at"`
+}
+
+// enqueueJobFunc queues a job. ?kind=sleep takes ?duration_ms; ?kind=fail
+// fails every attempt, ending up in the dead list.
+func enqueueJobFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "redis")
+	defer cancel()
+
+	kind := c.DefaultQuery("kind", "sleep")
+	if kind != "sleep" && kind != "fail" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be sleep or fail"})
+		return
+	}
+	durationMs, err := strconv.Atoi(c.DefaultQuery("duration_ms", "100"))
+	if err != nil || durationMs < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration_ms must be a non-negative integer"})
+		return
+	}
+	j := job{
+		ID:          randomHex(8),
+		Kind:        kind,
+		DurationMs:  durationMs,
+		Traceparent: traceparentFromContext(ctx),
+		EnqueuedAt:  clk.Now().UTC(),
+	}
+	if err = pushJob(ctx, j, "queued"); err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis enqueue error: %v", err)
+		return
+	}
+	jobStats.Add("enqueued", 1)
+	c.JSON(http.StatusAccepted, gin.H{"id": j.ID, "status": "queued"})
+}
+
+// getJobFunc returns the status of a job.
+func getJobFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "redis")
+	defer cancel()
+
+	status, err := rdb.Get(ctx, jobStatusPrefix+c.Param("id")).Result()
+	if errors.Is(err, redis.Nil) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis GET error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "status": status})
+}
+
+func pushJob(ctx context.Context, j job, status string) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, jobQueueKey, b)
+		p.Set(ctx, jobStatusPrefix+j.ID, status, 24*time.Hour)
+		return nil
+	})
+	return err
+}
+
+// runJobWorkers runs JOB_WORKERS workers processing the queue until ctx is
+// done.
+func runJobWorkers(ctx context.Context) {
+	if !stepAvailable("redis") {
+		return
+	}
+	for range getEnvInt("JOB_WORKERS", 4) {
+		go runJobWorker(ctx)
+	}
+}
+
+func runJobWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		raw, err := rdb.BLMove(ctx, jobQueueKey, jobProcessingKey, "RIGHT", "LEFT", 2*time.Second).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				slog.Warn("jobs: BLMOVE failed", "error", err)
+				sleepCtx(ctx, time.Second)
+			}
+			continue
+		}
+		handleJob(ctx, raw)
+		if n, err := rdb.LLen(ctx, jobQueueKey).Result(); err == nil {
+			depth := new(expvar.Int)
+			depth.Set(n)
+			jobStats.Set("queue_depth", depth)
+		}
+	}
+}
+
+// handleJob runs a job taken off the queue and removes it from the
+// processing list, requeueing it if it failed and has attempts left.
+func handleJob(ctx context.Context, raw string) {
+	var j job
+	if err := json.Unmarshal([]byte(raw), &j); err != nil {
+		slog.Warn("jobs: dropping undecodable job", "error", err)
+		_ = rdb.LRem(ctx, jobProcessingKey, 1, raw).Err()
+		return
+	}
+	j.Attempts++
+	traceID := randomHex(16)
+	start := clk.Now()
+	err := runJob(ctx, j)
+	slog.Info("jobs: job processed",
+		"id", j.ID,
+		"kind", j.Kind,
+		"attempt", j.Attempts,
+		"queued_for", start.Sub(j.EnqueuedAt),
+		"duration", clk.Since(start),
+		"error", err,
+		"trace_id", traceID,
+		"link_trace_id", parseTraceparent(j.Traceparent),
+	)
+
+	status := "done"
+	switch {
+	case err == nil:
+		jobStats.Add("processed", 1)
+	case j.Attempts < jobMaxAttempts:
+		status = "retrying"
+		jobStats.Add("retried", 1)
+		if err = pushJob(ctx, j, status); err != nil {
+			slog.Warn("jobs: requeueing failed", "id", j.ID, "error", err)
+		}
+	default:
+		status = "dead"
+		jobStats.Add("dead", 1)
+		recordEvent(context.WithValue(ctx, traceIDKey{}, traceID), "jobs", "job %s failed %d times, giving up", j.ID, j.Attempts)
+		if err = rdb.LPush(ctx, jobDeadKey, raw).Err(); err != nil {
+			slog.Warn("jobs: moving to dead list failed", "id", j.ID, "error", err)
+		}
+	}
+	_, err = rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LRem(ctx, jobProcessingKey, 1, raw)
+		if status != "retrying" {
+			p.Set(ctx, jobStatusPrefix+j.ID, status, 24*time.Hour)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("jobs: finishing job failed", "id", j.ID, "error", err)
+	}
+}
+
+func runJob(ctx context.Context, j job) error {
+	switch j.Kind {
+	case "fail":
+		return errJobFailed
+	default:
+		sleepCtx(ctx, time.Duration(j.DurationMs)*time.Millisecond)
+		return ctx.Err()
+	}
+}
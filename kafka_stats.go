@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// kafkaCounters accumulates the traffic of the kafka-go bus, which works on
+// a single partition connection and so has no Reader or Writer Stats() to
+// draw from. There is no consumer group either, hence no rebalances.
+var kafkaCounters kafkaTraffic
+
+// kafkaMetrics holds the Kafka metrics of the last stats interval, as
+// published by runKafkaStats.
+var kafkaMetrics = expvar.NewMap("kafka")
+
+type kafkaTraffic struct {
+	messagesProduced atomic.Int64
+	bytesProduced    atomic.Int64
+	messagesConsumed atomic.Int64
+	bytesConsumed    atomic.Int64
+	fetches          atomic.Int64
+	fetchNanos       atomic.Int64
+}
+
+func (t *kafkaTraffic) produced(messages, bytes int) {
+	t.messagesProduced.Add(int64(messages))
+	t.bytesProduced.Add(int64(bytes))
+}
+
+func (t *kafkaTraffic) consumed(bytes int) {
+	t.messagesConsumed.Add(1)
+	t.bytesConsumed.Add(int64(bytes))
+}
+
+func (t *kafkaTraffic) fetched(d time.Duration) {
+	t.fetches.Add(1)
+	t.fetchNanos.Add(int64(d))
+}
+
+type kafkaTotals struct {
+	messagesProduced, bytesProduced int64
+	messagesConsumed, bytesConsumed int64
+	fetches, fetchNanos             int64
+}
+
+func (t *kafkaTraffic) totals() kafkaTotals {
+	return kafkaTotals{
+		messagesProduced: t.messagesProduced.Load(),
+		bytesProduced:    t.bytesProduced.Load(),
+		messagesConsumed: t.messagesConsumed.Load(),
+		bytesConsumed:    t.bytesConsumed.Load(),
+		fetches:          t.fetches.Load(),
+		fetchNanos:       t.fetchNanos.Load(),
+	}
+}
+
+// runKafkaStats publishes consumer lag, throughput and fetch latency every
+// KAFKA_STATS_INTERVAL until ctx is done.
+func runKafkaStats(ctx context.Context) {
+	interval := getEnvDuration("KAFKA_STATS_INTERVAL", 15*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := kafkaCounters.totals()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		cur := kafkaCounters.totals()
+		perSec := func(cur, prev int64) *expvar.Float {
+			v := new(expvar.Float)
+			v.Set(float64(cur-prev) / interval.Seconds())
+			return v
+		}
+		kafkaMetrics.Set("produced_messages_per_sec", perSec(cur.messagesProduced, prev.messagesProduced))
+		kafkaMetrics.Set("produced_bytes_per_sec", perSec(cur.bytesProduced, prev.bytesProduced))
+		kafkaMetrics.Set("consumed_messages_per_sec", perSec(cur.messagesConsumed, prev.messagesConsumed))
+		kafkaMetrics.Set("consumed_bytes_per_sec", perSec(cur.bytesConsumed, prev.bytesConsumed))
+
+		fetchMs := new(expvar.Float)
+		if n := cur.fetches - prev.fetches; n > 0 {
+			fetchMs.Set(float64(cur.fetchNanos-prev.fetchNanos) / float64(n) / float64(time.Millisecond))
+		}
+		kafkaMetrics.Set("fetch_latency_avg_ms", fetchMs)
+
+		if lb, ok := bus.(interface{ Lag() (int64, error) }); ok {
+			lag, err := lb.Lag()
+			if err != nil {
+				slog.Warn("kafka: reading lag failed", "error", err)
+			} else {
+				v := new(expvar.Int)
+				v.Set(lag)
+				kafkaMetrics.Set("consumer_lag", v)
+			}
+		}
+		prev = cur
+	}
+}
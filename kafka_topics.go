@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaDLQTopicName is where messages that can't be processed are meant to
+// be parked.
+const kafkaDLQTopicName = kafkaTopicName + "_dlq"
+
+// initKafkaTopics creates the app's topics with KAFKA_PARTITIONS partitions
+// and KAFKA_REPLICATION replicas, rather than relying on the broker to
+// auto-create them with its defaults. Existing topics are left as they are.
+func initKafkaTopics(ctx context.Context) error {
+	if localMode() {
+		return nil
+	}
+	controller, err := dialKafkaController(ctx)
+	if err != nil {
+		return err
+	}
+	defer controller.Close()
+
+	for _, topic := range []string{kafkaTopicName, kafkaDLQTopicName} {
+		err = controller.CreateTopics(kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     getEnvInt("KAFKA_PARTITIONS", 1),
+			ReplicationFactor: getEnvInt("KAFKA_REPLICATION", 1),
+		})
+		if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialKafkaController connects to the cluster's controller, found through
+// the first broker that answers.
+func dialKafkaController(ctx context.Context) (*kafka.Conn, error) {
+	var errs []error
+	for _, addr := range kafkaBrokers {
+		conn, err := kafka.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		controller, err := conn.Controller()
+		_ = conn.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return kafka.DialContext(ctx, "tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	}
+	return nil, errors.Join(errs...)
+}
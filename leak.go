@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxLeakPerRequest = 10_000
+
+// maxLeaked bounds the goroutines /leak may have leaked at once.
+var maxLeaked = int64(getEnvInt("LEAK_MAX_GOROUTINES", 100_000))
+
+// leaked tracks the goroutines leaked by /leak. Closing release lets them
+// all return.
+var leaked struct {
+	sync.Mutex
+	release chan struct{}
+	count   atomic.Int64
+}
+
+func init() {
+	leaked.release = make(chan struct{})
+	expvar.Publish("leaked_goroutines", expvar.Func(func() any { return leaked.count.Load() }))
+}
+
+// leakFunc leaks ?n= goroutines the textbook way: each computes a result
+// for a caller that gives up waiting after ?timeout_ms=, and then blocks
+// forever sending it on an unbuffered channel nobody reads. They stay until
+// /admin/unleak, and carry the trace ID as a pprof label, so the goroutine
+// profile at /admin/pprof/goroutine?debug=1 points at the leaking request.
+func leakFunc(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "100"))
+	if err != nil || n < 1 || n > maxLeakPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "n must be between 1 and " + strconv.Itoa(maxLeakPerRequest)})
+		return
+	}
+	timeoutMs, err := strconv.Atoi(c.DefaultQuery("timeout_ms", "10"))
+	if err != nil || timeoutMs < 0 || timeoutMs > 10_000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout_ms must be between 0 and 10000"})
+		return
+	}
+	if leaked.count.Load()+int64(n) > maxLeaked {
+		c.JSON(http.StatusConflict, gin.H{"error": "LEAK_MAX_GOROUTINES would be exceeded, call /admin/unleak first"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	leaked.Lock()
+	release := leaked.release
+	leaked.Unlock()
+	results := make(chan int)
+	labels := pprof.Labels("trace_id", traceIDFromContext(ctx), "route", c.FullPath())
+	pprof.Do(ctx, labels, func(context.Context) {
+		for range n {
+			leaked.count.Add(1)
+			go func() {
+				defer leaked.count.Add(-1)
+				clk.Sleep(2*timeout + time.Millisecond)
+				select {
+				case results <- 42:
+				case <-release:
+				}
+			}()
+		}
+	})
+	select {
+	case <-results:
+	case <-clk.After(timeout):
+	case <-ctx.Done():
+	}
+
+	total := leaked.count.Load()
+	slog.Debug("goroutines leaked",
+		"trace_id", traceIDFromContext(ctx),
+		"n", n,
+		"leaked", total,
+	)
+	c.JSON(http.StatusOK, gin.H{"leaked": n, "total_leaked": total})
+}
+
+// unleakFunc releases the goroutines leaked by /leak.
+func unleakFunc(c *gin.Context) {
+	leaked.Lock()
+	released := leaked.count.Load()
+	close(leaked.release)
+	leaked.release = make(chan struct{})
+	leaked.Unlock()
+	c.JSON(http.StatusOK, gin.H{"released": released})
+}
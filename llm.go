@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAI compatible chat completion API. When LLM_BASE_URL is unset, the
+// built-in mock under /llm/mock is used so no API key is needed.
+var (
+	llmBaseURL = getEnv("LLM_BASE_URL", "http://localhost:8000/llm/mock/v1")
+	llmAPIKey  = getEnv("LLM_API_KEY", "")
+	llmModel   = getEnv("LLM_MODEL", "gpt-4o-mini")
+)
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func llmFunc(c *gin.Context) {
+	body, _ := json.Marshal(chatRequest{
+		Model:    llmModel,
+		Messages: []chatMessage{{Role: "user", Content: c.DefaultQuery("prompt", "Say hello")}},
+	})
+	req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodPost,
+		llmBaseURL+"/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	setPropagationHeaders(c.Request.Context(), req)
+	if llmAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+llmAPIKey)
+	}
+
+	resp, err := hcl.Do(req)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "LLM call error: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respondError(c, http.StatusBadGateway, "LLM call error: %s", resp.Status)
+		return
+	}
+	var out chatResponse
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		respondError(c, http.StatusInternalServerError, "LLM decode error: %v", err)
+		return
+	}
+
+	var content string
+	if len(out.Choices) > 0 {
+		content = out.Choices[0].Message.Content
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"model":             out.Model,
+		"prompt_tokens":     out.Usage.PromptTokens,
+		"completion_tokens": out.Usage.CompletionTokens,
+		"content":           content,
+	})
+}
+
+// llmMockFunc is a minimal stand-in for an OpenAI compatible
+// /chat/completions endpoint that echoes the prompt back.
+func llmMockFunc(c *gin.Context) {
+	var req chatRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	var prompt []string
+	for _, m := range req.Messages {
+		prompt = append(prompt, m.Content)
+	}
+	reply := fmt.Sprintf("You said: %s", strings.Join(prompt, " "))
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "chat.completion",
+		"model":  req.Model,
+		"choices": []gin.H{{
+			"index":         0,
+			"message":       chatMessage{Role: "assistant", Content: reply},
+			"finish_reason": "stop",
+		}},
+		"usage": gin.H{
+			"prompt_tokens":     countTokens(strings.Join(prompt, " ")),
+			"completion_tokens": countTokens(reply),
+		},
+	})
+}
+
+// countTokens approximates a token count by counting words.
+func countTokens(s string) int {
+	return len(strings.Fields(s))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyHistogram records latencies to two significant digits, like an
+// HDR histogram, so its size grows with the range of latencies rather than
+// with the number of requests.
+type latencyHistogram struct {
+	mu       sync.Mutex
+	counts   map[time.Duration]int64
+	total    int64
+	sum      time.Duration
+	min, max time.Duration
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: map[time.Duration]int64{}}
+}
+
+// latencyBucket rounds d down to two significant digits of microseconds.
+func latencyBucket(d time.Duration) time.Duration {
+	us := d.Microseconds()
+	if us < 100 {
+		return time.Duration(us) * time.Microsecond
+	}
+	scale := int64(math.Pow10(int(math.Log10(float64(us))) - 1))
+	return time.Duration(us/scale*scale) * time.Microsecond
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[latencyBucket(d)]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	h.max = max(h.max, d)
+	h.total++
+	h.sum += d
+}
+
+// quantile returns the bucket holding the q-th quantile of the latencies.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	buckets := make([]time.Duration, 0, len(h.counts))
+	for b := range h.counts {
+		buckets = append(buckets, b)
+	}
+	slices.Sort(buckets)
+	rank := int64(math.Ceil(q * float64(h.total)))
+	var seen int64
+	for _, b := range buckets {
+		seen += h.counts[b]
+		if seen >= rank {
+			return b
+		}
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// vegetaMetrics is the JSON report of `vegeta report -type=json`, so that
+// soak runs can be compared with runs of common load-testing tools.
+type vegetaMetrics struct {
+	Latencies struct {
+		Total time.Duration `json:"total"`
+		Mean  time.Duration `json:"mean"`
+		P50   time.Duration `json:"50th"`
+		P90   time.Duration `json:"90th"`
+		P95   time.Duration `json:"95th"`
+		P99   time.Duration `json:"99th"`
+		Max   time.Duration `json:"max"`
+		Min   time.Duration `json:"min"`
+	} `json:"latencies"`
+	BytesIn struct {
+		Total uint64  `json:"total"`
+		Mean  float64 `json:"mean"`
+	} `json:"bytes_in"`
+	BytesOut struct {
+		Total uint64  `json:"total"`
+		Mean  float64 `json:"mean"`
+	} `json:"bytes_out"`
+	Earliest    time.Time      `json:"earliest"`
+	Latest      time.Time      `json:"latest"`
+	End         time.Time      `json:"end"`
+	Duration    time.Duration  `json:"duration"`
+	Wait        time.Duration  `json:"wait"`
+	Requests    uint64         `json:"requests"`
+	Rate        float64        `json:"rate"`
+	Throughput  float64        `json:"throughput"`
+	Success     float64        `json:"success"`
+	StatusCodes map[string]int `json:"status_codes"`
+	Errors      []string       `json:"errors"`
+}
+
+// vegetaReport summarizes the requests of the soak run the way vegeta
+// does. Wait, the time between the last request and its response, isn't
+// tracked and is left at zero.
+func (r *soakRun) vegetaReport() vegetaMetrics {
+	var m vegetaMetrics
+	h := r.latencies
+	h.mu.Lock()
+	m.Latencies.Total, m.Latencies.Min, m.Latencies.Max = h.sum, h.min, h.max
+	requests := h.total
+	h.mu.Unlock()
+	m.Latencies.Mean = h.mean()
+	m.Latencies.P50 = h.quantile(0.5)
+	m.Latencies.P90 = h.quantile(0.9)
+	m.Latencies.P95 = h.quantile(0.95)
+	m.Latencies.P99 = h.quantile(0.99)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m.Requests = uint64(requests)
+	m.BytesIn.Total = uint64(r.bytesIn.Load())
+	if requests > 0 {
+		m.BytesIn.Mean = float64(m.BytesIn.Total) / float64(requests)
+	}
+	m.Earliest, m.Latest = r.started, r.lastRequest
+	m.End = r.lastRequest
+	m.Duration = r.lastRequest.Sub(r.started)
+	if m.Duration > 0 {
+		m.Rate = float64(requests) / m.Duration.Seconds()
+	}
+	var ok int
+	m.StatusCodes = map[string]int{}
+	for code, n := range r.statusCodes {
+		m.StatusCodes[strconv.Itoa(code)] = n
+		if code >= 200 && code < 400 {
+			ok += n
+		}
+	}
+	if requests > 0 {
+		m.Success = float64(ok) / float64(requests)
+	}
+	if m.Duration > 0 {
+		m.Throughput = float64(ok) / m.Duration.Seconds()
+	}
+	m.Errors = slices.Sorted(maps.Keys(r.errorMessages))
+	return m
+}
+
+// writeVegetaReport writes the vegeta report of the soak run to path.
+func (r *soakRun) writeVegetaReport(path string) error {
+	b, err := json.MarshalIndent(r.vegetaReport(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want time.Duration
+	}{
+		{0, 0},
+		{500 * time.Nanosecond, 0},
+		{42 * time.Microsecond, 42 * time.Microsecond},
+		{99 * time.Microsecond, 99 * time.Microsecond},
+		{123 * time.Microsecond, 120 * time.Microsecond},
+		{1999 * time.Microsecond, 1900 * time.Microsecond},
+		{12345 * time.Microsecond, 12 * time.Millisecond},
+		{3*time.Second + 456*time.Millisecond, 3400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := latencyBucket(tt.d); got != tt.want {
+			t.Errorf("latencyBucket(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		quantiles map[float64]time.Duration
+		mean      time.Duration
+	}{
+		{
+			name:      "empty",
+			quantiles: map[float64]time.Duration{0.5: 0, 1: 0},
+		},
+		{
+			name:      "single",
+			latencies: []time.Duration{5 * time.Millisecond},
+			quantiles: map[float64]time.Duration{0: 5 * time.Millisecond, 0.5: 5 * time.Millisecond, 1: 5 * time.Millisecond},
+			mean:      5 * time.Millisecond,
+		},
+		{
+			name: "spread",
+			latencies: []time.Duration{
+				1 * time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond,
+				6 * time.Millisecond, 7 * time.Millisecond, 8 * time.Millisecond, 9 * time.Millisecond, 100 * time.Millisecond,
+			},
+			quantiles: map[float64]time.Duration{
+				0.1:  1 * time.Millisecond,
+				0.5:  5 * time.Millisecond,
+				0.9:  9 * time.Millisecond,
+				0.95: 100 * time.Millisecond,
+				1:    100 * time.Millisecond,
+			},
+			mean: 14500 * time.Microsecond,
+		},
+		{
+			name:      "bucketed",
+			latencies: []time.Duration{1234 * time.Microsecond, 1250 * time.Microsecond, 1299 * time.Microsecond},
+			quantiles: map[float64]time.Duration{0.5: 1200 * time.Microsecond, 1: 1200 * time.Microsecond},
+			mean:      1261 * time.Microsecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newLatencyHistogram()
+			for _, d := range tt.latencies {
+				h.record(d)
+			}
+			for q, want := range tt.quantiles {
+				if got := h.quantile(q); got != want {
+					t.Errorf("quantile(%v) = %s, want %s", q, got, want)
+				}
+			}
+			if got := h.mean(); got != tt.mean {
+				t.Errorf("mean() = %s, want %s", got, tt.mean)
+			}
+		})
+	}
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
-	"io"
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -15,7 +20,6 @@ import (
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/redis/go-redis/v9"
-	"github.com/segmentio/kafka-go"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -24,13 +28,28 @@ import (
 
 const kafkaTopicName = "sample_topic"
 
+// kafkaBrokers are the addresses of the Kafka brokers, from KAFKA_BROKERS.
+var kafkaBrokers = strings.Split(getEnv("KAFKA_BROKERS", "kafka:9092"), ",")
+
 var (
 	hcl     http.Client
 	mysqldb *sql.DB
-	rdb     *redis.Client
+	rdb     redis.UniversalClient
 	mdb     *mongo.Client
 	ccn     driver.Conn
-	kcn     *kafka.Conn
+
+	clickhouseWriters *nodePool[driver.Conn]
+)
+
+// circuit breakers guarding the datastores, along with the last good
+// results served as fallbacks while a breaker is open
+var (
+	mysqlBreaker      = newBreaker("mysql")
+	mongoBreaker      = newBreaker("mongo")
+	clickhouseBreaker = newBreaker("clickhouse")
+
+	mysqlFallback      expvar.String
+	clickhouseFallback expvar.String
 )
 
 func main() {
@@ -42,96 +61,404 @@ func main() {
 func run() error {
 	var err error
 
-	// initialize http client
-	hcl = http.Client{}
+	// initialize logging
+	initLogging()
+	initMaxProcs()
 
-	// initialize mysql
-	mysqldb, err = sql.Open("mysql", "root:root@tcp(mysql:3306)/test")
-	if err != nil {
-		return err
-	}
-	if err = mysqldb.Ping(); err != nil {
+	// initialize http client
+	if hcl, err = newHTTPClient(); err != nil {
 		return err
 	}
-	defer func() {
-		_ = mysqldb.Close()
-	}()
 
-	// initialize redis
-	rdb = redis.NewClient(&redis.Options{
-		Addr: "redis:6379",
+	// initialize backends, independent ones in parallel; LOCAL_MODE skips
+	// those needing containers
+	defer closeBackends()
+	local := localMode()
+	var cacheDeps []string
+	if !memoryCacheMode() {
+		cacheDeps = []string{"redis"}
+	}
+	err = runSteps(context.Background(), []initStep{
+		{name: "mysql", skip: local, run: initMySQL},
+		{name: "migrations", deps: []string{"mysql"}, timeout: 30 * time.Second, run: initMigrations},
+		{name: "mssql", skip: local, optional: true, run: initMSSQL},
+		{name: "sqlite", run: initSQLite},
+		{name: "redis", skip: local, run: initRedis},
+		{name: "cache", deps: cacheDeps, run: initCache},
+		{name: "hashring", skip: local, run: initHashRing},
+		{name: "memcached", skip: local, optional: true, run: initMemcached},
+		{name: "etcd", skip: local, optional: true, run: initEtcd},
+		{name: "mongo", skip: local, run: initMongo},
+		{name: "couchbase", skip: local, optional: true, run: initCouchbase},
+		{name: "neo4j", skip: local, optional: true, run: initNeo4j},
+		{name: "clickhouse", skip: local, run: initClickhouse},
+		{name: "kafka-topics", run: initKafkaTopics},
+		{name: "kafka", deps: []string{"kafka-topics"}, run: initKafka},
+		{name: "s3", skip: local, run: initS3},
+		{name: "sqs", skip: local, run: initSQS},
+		{name: "dynamodb", skip: local, run: initDynamoDB},
+		{name: "discovery", run: initDiscovery},
+		{name: "etl", deps: []string{"clickhouse"}, run: initETL},
+		{name: "repositories", deps: []string{"migrations", "mongo", "clickhouse"}, run: initRepositories},
+		{name: "seed", deps: []string{"repositories", "cache"}, timeout: time.Minute, run: initSeed},
 	})
-
-	// initialize mongo
-	mdbOpts := options.Client().ApplyURI("mongodb://mongo:27017")
-	mdb, err = mongo.Connect(context.Background(), mdbOpts)
 	if err != nil {
 		return err
 	}
-	if err = mdb.Ping(context.Background(), readpref.Primary()); err != nil {
+	if err = initUploadStore(); err != nil {
 		return err
 	}
-	defer func() {
-		_ = mdb.Disconnect(context.Background())
-	}()
 
-	// initialize clickhouse
-	ccn, err = clickhouse.Open(&clickhouse.Options{
-		Addr: []string{"clickhouse:9000"},
-	})
+	// start background workers
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go runRedisSubscriber(workers)
+	go runStreamWorker(workers)
+	go runHeartbeat(workers)
+	go runOrderWatcher(workers)
+	go runKafkaStats(workers)
+	go runOutboxRelay(workers)
+	go runJobWorkers(workers)
+
+	tlsConfig, err := serverTLSConfig()
 	if err != nil {
 		return err
 	}
-	if err = ccn.Ping(context.Background()); err != nil {
-		return err
-	}
 
-	// initialize kafka
-	kcn, err = kafka.DialLeader(context.Background(), "tcp", "kafka:9092", kafkaTopicName, 0)
+	// Create Gin router
+	engine := gin.Default()
+	loadTemplates(engine)
+	// CORS goes ahead of the middlewares that may reject a request, so that
+	// preflights are answered and rejections carry CORS headers
+	engine.Use(traceContextMiddleware(), requestIDMiddleware(), traceLogMiddleware(), statsMiddleware(), corsMiddleware(), tenantMiddleware(), clientCertMiddleware(), protocolMiddleware(), identityMiddleware(), compressMiddleware(), etagMiddleware(), timeoutMiddleware(), apiKeyMiddleware(), quotaMiddleware(), bodyCaptureMiddleware(), idempotencyMiddleware())
+	router := trackRoutes(&engine.RouterGroup)
+	rpcGateway, err := newRPCGateway()
 	if err != nil {
 		return err
 	}
 
-	// Create Gin router
-	router := gin.Default()
-
 	// Define routes
 	router.GET("/", indexFunc)
+	router.GET("/app/*filepath", appFunc())
 	router.GET("/param/:param", paramFunc)
 	router.GET("/exception", exceptionFunc)
 	router.GET("/api", apiFunc)
-	router.GET("/mysql", mysqlFunc)
-	router.GET("/redis", redisFunc)
-	router.GET("/mongo", mongoFunc)
-	router.GET("/clickhouse", clickhouseFunc)
-	router.GET("/kafka/produce", kafkaProduceFunc)
-	router.GET("/kafka/consume", kafkaConsumeFunc)
+	router.GET("/mysql", requireSteps("mysql"), mysqlFunc)
+	router.GET("/mysql/slow", requireSteps("mysql"), mysqlSlowFunc)
+	router.GET("/mssql", requireSteps("mssql"), mssqlFunc)
+	router.GET("/sqlite", sqliteFunc)
+	router.GET("/redis", requireSteps("cache"), redisFunc(appCache))
+	router.GET("/redis/publish", requireSteps("redis"), redisPublishFunc)
+	router.GET("/redis/streams/add", requireSteps("redis"), streamsAddFunc)
+	router.GET("/hashring/:key", requireSteps("hashring"), hashringFunc)
+	router.GET("/memcached", requireSteps("memcached"), memcachedFunc)
+	router.GET("/grpc/echo", grpcEchoFunc)
+	router.GET("/grpc/events", grpcEventsFunc)
+	router.GET("/grpc/upload", grpcUploadFunc)
+	router.GET("/rpc/*path", gin.WrapH(rpcGateway))
+	router.POST("/rpc/*path", gin.WrapH(rpcGateway))
+	router.GET("/etcd/:key", requireSteps("etcd"), etcdGetFunc)
+	router.PUT("/etcd/:key", requireSteps("etcd"), etcdPutFunc)
+	router.GET("/mongo", requireSteps("mongo"), mongoFunc)
+	router.GET("/mongo/txn", requireSteps("mongo"), mongoTxnFunc)
+	router.GET("/mongo/slow", requireSteps("mongo"), mongoSlowFunc)
+	router.GET("/couchbase/:key", requireSteps("couchbase"), couchbaseGetFunc)
+	router.PUT("/couchbase/:key", requireSteps("couchbase"), couchbaseUpsertFunc)
+	router.GET("/neo4j", requireSteps("neo4j"), neo4jFunc)
+	router.GET("/clickhouse", requireSteps("clickhouse"), clickhouseFunc)
+	router.GET("/clickhouse/slow", requireSteps("clickhouse"), clickhouseSlowFunc)
+	router.GET("/kafka/produce", kafkaProduceFunc(bus))
+	router.GET("/kafka/consume", kafkaConsumeFunc(bus))
+	registerDomainRoutes(router.Group("/v1", apiVersionMiddleware(1), requireSteps("repositories")))
+	registerDomainRoutes(router.Group("/v2", apiVersionMiddleware(2), requireSteps("repositories")))
+	registerDomainRoutes(router.Group("", apiVersionMiddleware(1), requireSteps("repositories")))
+	gormGroup := router.Group("/gorm", requireSteps("repositories"))
+	gormGroup.POST("/users", createUserFunc(gormUserRepo))
+	gormGroup.GET("/users", listUsersFunc(gormUserRepo))
+	gormGroup.GET("/users/:id", getUserFunc(gormUserRepo))
+	sqlxGroup := router.Group("/sqlx", requireSteps("repositories"))
+	sqlxGroup.POST("/users", createUserFunc(sqlxUserRepo))
+	sqlxGroup.GET("/users", listUsersFunc(sqlxUserRepo))
+	sqlxGroup.GET("/users/:id", getUserFunc(sqlxUserRepo))
+	router.POST("/outbox/orders", requireSteps("migrations"), createOutboxOrderFunc)
+	router.POST("/checkout", requireSteps("migrations", "mongo"), checkoutFunc)
+	router.POST("/jobs", requireSteps("redis"), enqueueJobFunc)
+	router.GET("/jobs/:id", requireSteps("redis"), getJobFunc)
+	router.POST("/etl/run", requireSteps("migrations", "etl"), etlRunFunc)
+	router.POST("/upload", uploadFunc)
+	router.GET("/upload/:name", downloadUploadFunc)
+	router.GET("/s3/put", requireSteps("s3"), s3PutFunc)
+	router.GET("/s3/get", requireSteps("s3"), s3GetFunc)
+	router.GET("/sqs/send", requireSteps("sqs"), sqsSendFunc)
+	router.GET("/sqs/receive", requireSteps("sqs"), sqsReceiveFunc)
+	router.GET("/dynamodb", requireSteps("dynamodb"), dynamodbFunc)
+	router.GET("/payload", payloadFunc)
+	router.GET("/large", largeFunc)
+	router.GET("/download/:file", downloadFunc)
+	router.GET("/negotiate", negotiateFunc)
+	router.GET("/work/hash", workHashFunc)
+	router.GET("/work/io", workIOFunc)
+	router.GET("/burn/:ms", burnFunc)
+	router.GET("/alloc/:mb", allocFunc)
+	router.GET("/leak", leakFunc)
+	router.GET("/email", emailFunc)
+	router.GET("/llm", llmFunc)
+	router.POST("/llm/mock/v1/chat/completions", llmMockFunc)
+	router.GET("/quota", requireSteps("redis"), quotaFunc)
+	router.GET("/region", regionFunc)
+	router.GET("/region/call", regionCallFunc)
+	router.GET("/cluster", requireSteps("redis"), clusterFunc)
+	router.GET("/healthz", healthzFunc)
+	router.GET("/readyz", readyzFunc)
+	router.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+	router.GET("/ws/metrics", wsMetricsFunc)
+	router.GET("/debug/events", debugEventsFunc)
+	router.GET("/debug/top", debugTopFunc)
+	router.GET("/debug/runtime", debugRuntimeFunc)
+	router.GET("/debug/cpuquota", debugCPUQuotaFunc)
+	router.GET("/debug/soak", debugSoakFunc)
+	router.GET("/debug/routes", debugRoutesFunc)
+	router.GET("/dashboard", dashboardFunc)
+
+	session := router.Group("", sessionsMiddleware())
+	session.POST("/login", requireSteps("repositories"), loginFunc)
+	session.GET("/session", sessionFunc)
+	session.POST("/logout", logoutFunc)
+	session.GET("/auth/login", oidcLoginFunc)
+	session.GET("/auth/callback", oidcCallbackFunc)
+
+	admin := router.Group("/admin", adminAuth())
+	admin.GET("/loglevel", getLogLevelFunc)
+	admin.PUT("/loglevel", setLogLevelFunc)
+	admin.GET("/tracer", getTracerFunc)
+	admin.PUT("/tracer", setTracerFunc)
+	admin.GET("/clock", getClockFunc)
+	admin.PUT("/clock", setClockFunc)
+	admin.DELETE("/alloc", freeFunc)
+	admin.POST("/unleak", unleakFunc)
+	admin.GET("/pprof/*name", pprofFunc)
+	admin.GET("/scenario", listScenariosFunc)
+	admin.GET("/scenario/:name", getScenarioFunc)
+	admin.POST("/scenario/:name", startScenarioFunc(selfURL(tlsConfig)))
+	admin.DELETE("/scenario/:name", stopScenarioFunc)
 
 	// Graceful shutdown
 	srv := &http.Server{
 		Addr:    ":8000",
-		Handler: router,
+		Handler: engine,
 	}
 
 	// Handle SIGINT (CTRL+C)
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	upg, err := newUpgrader()
+	if err != nil {
+		return err
+	}
+	defer upg.Stop()
+
+	ln, err := upg.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		srv.TLSConfig = tlsConfig
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	srv.Handler = withH2C(engine, tlsConfig)
+	h3Srv, err := serveHTTP3(upg, engine, tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer stopHTTP3(h3Srv)
+	grpcSrv, err := serveGRPC(upg)
+	if err != nil {
+		return err
+	}
+	defer stopGRPC(grpcSrv)
 	srvErr := make(chan error, 1)
 	go func() {
-		log.Println("Server started on :8000")
-		srvErr <- srv.ListenAndServe()
+		slog.Info("server started", "addr", srv.Addr, "tls", tlsConfig != nil, "mtls", tlsConfig != nil && tlsConfig.ClientCAs != nil)
+		srvErr <- srv.Serve(ln)
 	}()
+	// the old process, if any, keeps serving until this one is warm;
+	// warmUp gives up after WARMUP_TIMEOUT
+	warmUp(ctx, selfURL(tlsConfig))
+	go runSoak(ctx, selfURL(tlsConfig))
+	if err = upg.Ready(); err != nil {
+		return err
+	}
 
 	select {
 	case err = <-srvErr:
 		return err
 	case <-ctx.Done():
 		stop()
-		log.Println("Shutting down server...")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		return srv.Shutdown(shutdownCtx)
+	case <-upg.Exit():
+		slog.Info("new process took over, draining connections")
+	}
+	slog.Info("shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// Backends
+
+func initMySQL(ctx context.Context) error {
+	db, err := sql.Open("mysql", "root:root@tcp(mysql:3306)/test?parseTime=true")
+	if err != nil {
+		return err
+	}
+	mysqldb = db
+	return mysqldb.PingContext(ctx)
+}
+
+// initRedis connects to Redis in the topology selected by REDIS_MODE:
+// single (REDIS_ADDR), cluster (REDIS_CLUSTER_ADDRS) or sentinel
+// (REDIS_SENTINEL_ADDRS and REDIS_MASTER_NAME).
+func initRedis(ctx context.Context) error {
+	switch mode := getEnv("REDIS_MODE", "single"); mode {
+	case "single":
+		rdb = redis.NewClient(&redis.Options{
+			Addr: getEnv("REDIS_ADDR", "redis:6379"),
+		})
+	case "cluster":
+		rdb = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs: strings.Split(getEnv("REDIS_CLUSTER_ADDRS", "redis:6379"), ","),
+		})
+	case "sentinel":
+		rdb = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    getEnv("REDIS_MASTER_NAME", "mymaster"),
+			SentinelAddrs: strings.Split(getEnv("REDIS_SENTINEL_ADDRS", "redis-sentinel:26379"), ","),
+		})
+	default:
+		return fmt.Errorf("unknown REDIS_MODE %q", mode)
+	}
+	return rdb.Ping(ctx).Err()
+}
+
+// memoryCacheMode reports whether the cache lives in process rather than in
+// Redis: in local mode, or with CACHE_BACKEND=memory.
+func memoryCacheMode() bool {
+	return localMode() || getEnv("CACHE_BACKEND", "redis") == "memory"
+}
+
+func initCache(context.Context) error {
+	if memoryCacheMode() {
+		appCache = newMemoryCache(clk)
+	} else {
+		appCache = redisCache{client: rdb}
+	}
+	return nil
+}
+
+func initMongo(ctx context.Context) error {
+	mdbOpts := options.Client().
+		ApplyURI(getEnv("MONGO_URI", "mongodb://mongo:27017/?directConnection=true")).
+		SetTimeout(backendTimeouts["mongo"])
+	client, err := mongo.Connect(ctx, mdbOpts)
+	if err != nil {
+		return err
+	}
+	mdb = client
+	return mdb.Ping(ctx, readpref.Primary())
+}
+
+// initClickhouse connects to the CLICKHOUSE_ADDRS nodes. Queries go through
+// ccn, which spreads its connections over the nodes; writes go through
+// clickhouseWriters, which steers clear of failing nodes.
+func initClickhouse(ctx context.Context) error {
+	addrs := strings.Split(getEnv("CLICKHOUSE_ADDRS", "clickhouse:9000"), ",")
+	conn, err := clickhouse.Open(&clickhouse.Options{
+		Addr:             addrs,
+		ConnOpenStrategy: clickhouse.ConnOpenRoundRobin,
+		ReadTimeout:      backendTimeouts["clickhouse"],
+	})
+	if err != nil {
+		return err
+	}
+	ccn = conn
+	clickhouseWriters, err = newNodePool("clickhouse", addrs, func(addr string) (driver.Conn, error) {
+		return clickhouse.Open(&clickhouse.Options{
+			Addr:        []string{addr},
+			ReadTimeout: backendTimeouts["clickhouse"],
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return ccn.Ping(ctx)
+}
+
+// initKafka connects to Kafka with the client selected by KAFKA_CLIENT:
+// segmentio (kafka-go), sarama or confluent (confluent-kafka-go).
+func initKafka(ctx context.Context) error {
+	if localMode() {
+		bus = newMemoryBus()
+		return nil
+	}
+	switch client := getEnv("KAFKA_CLIENT", "segmentio"); client {
+	case "segmentio":
+		kb, err := newKafkaBus(ctx, kafkaBrokers, kafkaTopicName)
+		if err != nil {
+			return err
+		}
+		bus = kb
+	case "sarama":
+		sb, err := newSaramaBus(kafkaBrokers, kafkaTopicName)
+		if err != nil {
+			return err
+		}
+		bus = sb
+	case "confluent":
+		cb, err := newConfluentBus(kafkaBrokers, kafkaTopicName)
+		if err != nil {
+			return err
+		}
+		bus = cb
+	default:
+		return fmt.Errorf("unknown KAFKA_CLIENT %q", client)
+	}
+	return nil
+}
+
+// closeBackends releases whichever backends were initialized.
+func closeBackends() {
+	deregisterDiscovery()
+	if mysqldb != nil {
+		_ = mysqldb.Close()
+	}
+	if mssqldb != nil {
+		_ = mssqldb.Close()
+	}
+	if sqlitedb != nil {
+		_ = sqlitedb.Close()
+	}
+	if rdb != nil {
+		_ = rdb.Close()
+	}
+	for _, cl := range ringClients {
+		_ = cl.Close()
+	}
+	if etcd != nil {
+		_ = etcd.Close()
+	}
+	if mdb != nil {
+		_ = mdb.Disconnect(context.Background())
+	}
+	if n4j != nil {
+		_ = n4j.Close(context.Background())
+	}
+	if ccn != nil {
+		_ = ccn.Close()
+	}
+	if clickhouseWriters != nil {
+		clickhouseWriters.each(func(_ string, conn driver.Conn) { _ = conn.Close() })
+	}
+	if bus != nil {
+		_ = bus.Close()
 	}
 }
 
@@ -147,78 +474,194 @@ func paramFunc(c *gin.Context) {
 }
 
 func exceptionFunc(c *gin.Context) {
-	c.Status(http.StatusInternalServerError)
+	respondError(c, http.StatusInternalServerError, "exception called")
 }
 
 func apiFunc(c *gin.Context) {
-	req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, "http://localhost:8000/", nil)
-	resp, err := hcl.Do(req)
+	base, err := downstreamURL(c.Request.Context())
 	if err != nil {
-		c.String(http.StatusInternalServerError, "API call error: %v", err)
+		respondError(c, http.StatusBadGateway, "Service discovery error: %v", err)
 		return
 	}
-	defer resp.Body.Close()
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, coalesced, err := apiFetcher.Get(c.Request.Context(), base+"/")
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Read error: %v", err)
+		respondError(c, http.StatusInternalServerError, "API call error: %v", err)
 		return
 	}
+	if coalesced {
+		c.Header("X-Coalesced", "true")
+	}
 	c.String(http.StatusOK, "Got api: %s", respBody)
 }
 
 func mysqlFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "mysql")
+	defer cancel()
+	release, err := mysqlBulkhead.acquire(ctx)
+	if err != nil {
+		respondBulkheadError(c, err)
+		return
+	}
+	defer release()
+
 	var now string
-	err := mysqldb.QueryRow("SELECT NOW()").Scan(&now)
+	err = mysqlBreaker.Do(c.Request.Context(), func() error {
+		if stmt := mysqlNowStmt.Load(); stmt != nil {
+			return stmt.QueryRowContext(ctx).Scan(&now)
+		}
+		return mysqldb.QueryRowContext(ctx, "SELECT NOW()").Scan(&now)
+	})
+	if errors.Is(err, errBreakerOpen) {
+		c.Header("X-Fallback", "true")
+		c.String(http.StatusOK, "MySQL called (fallback): %s", mysqlFallback.Value())
+		return
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, "MySQL query error: %v", err)
+		respondError(c, http.StatusInternalServerError, "MySQL query error: %v", err)
 		return
 	}
+	mysqlFallback.Set(now)
 	c.String(http.StatusOK, "MySQL called: %s", now)
 }
 
-func redisFunc(c *gin.Context) {
-	val, err := rdb.Get(c.Request.Context(), "key").Result()
-	if err == redis.Nil {
-		c.String(http.StatusOK, "Redis called")
-		return
-	} else if err != nil {
-		c.String(http.StatusInternalServerError, "Redis error: %v", err)
-		return
+func redisFunc(store cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := backendContext(c.Request.Context(), "redis")
+		defer cancel()
+
+		val, err := retry(ctx, redisRetry, func(ctx context.Context) (string, error) {
+			return store.Get(ctx, "key")
+		})
+		if errors.Is(err, errCacheMiss) {
+			c.String(http.StatusOK, "Redis called")
+			return
+		} else if err != nil {
+			respondError(c, http.StatusInternalServerError, "Redis error: %v", err)
+			return
+		}
+		c.String(http.StatusOK, "Redis called: %s", val)
 	}
-	c.String(http.StatusOK, "Redis called: %s", val)
 }
 
 func mongoFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "mongo")
+	defer cancel()
+
 	collection := mdb.Database("sample_db").Collection("sampleCollection")
-	_ = collection.FindOne(c.Request.Context(), bson.D{{Key: "name", Value: "dummy"}})
+	err := mongoBreaker.Do(c.Request.Context(), func() error {
+		err := collection.FindOne(ctx, bson.D{{Key: "name", Value: "dummy"}}).Err()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, errBreakerOpen) {
+		c.Header("X-Fallback", "true")
+		c.String(http.StatusOK, "Mongo called (fallback)")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Mongo error: %v", err)
+		return
+	}
 	c.String(http.StatusOK, "Mongo called")
 }
 
 func clickhouseFunc(c *gin.Context) {
-	res, err := ccn.Query(c.Request.Context(), "SELECT NOW()")
+	ctx, cancel := backendContext(c.Request.Context(), "clickhouse")
+	defer cancel()
+	release, err := clickhouseBulkhead.acquire(ctx)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Clickhouse query error: %v", err)
+		respondBulkheadError(c, err)
 		return
 	}
-	c.String(http.StatusOK, "Clickhouse called: %v", res.Columns())
-}
+	defer release()
 
-func kafkaProduceFunc(c *gin.Context) {
-	kcn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	_, err := kcn.WriteMessages(
-		kafka.Message{Value: []byte("one!")},
-		kafka.Message{Value: []byte("two!")},
-		kafka.Message{Value: []byte("three!")},
-	)
+	var columns []string
+	err = clickhouseBreaker.Do(c.Request.Context(), func() error {
+		res, err := ccn.Query(ctx, "SELECT NOW()")
+		if err != nil {
+			return err
+		}
+		defer res.Close()
+		columns = res.Columns()
+		return nil
+	})
+	if errors.Is(err, errBreakerOpen) {
+		c.Header("X-Fallback", "true")
+		c.String(http.StatusOK, "Clickhouse called (fallback): %s", clickhouseFallback.Value())
+		return
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Kafka produce error: %v", err)
+		respondError(c, http.StatusInternalServerError, "Clickhouse query error: %v", err)
 		return
 	}
-	c.String(http.StatusOK, "Kafka produced")
+	clickhouseFallback.Set(fmt.Sprint(columns))
+	c.String(http.StatusOK, "Clickhouse called: %v", columns)
 }
 
-func kafkaConsumeFunc(c *gin.Context) {
-	kcn.SetReadDeadline(time.Now().Add(10 * time.Second))
-	_ = kcn.ReadBatch(10e3, 1e6) // fetch 10KB min, 1MB max
-	c.String(http.StatusOK, "Kafka consumed")
+func kafkaProduceFunc(b messageBus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := backendContext(c.Request.Context(), "kafka")
+		defer cancel()
+
+		var msgs []message
+		for _, body := range []string{"one!", "two!", "three!"} {
+			value, err := encodeMessageValue(ctx, body)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, "Kafka encode error: %v", err)
+				return
+			}
+			msgs = append(msgs, message{Value: value, Headers: newMessageHeaders(ctx)})
+		}
+		if err := b.Produce(ctx, msgs...); err != nil {
+			respondError(c, http.StatusInternalServerError, "Kafka produce error: %v", err)
+			return
+		}
+		c.String(http.StatusOK, "Kafka produced")
+	}
+}
+
+func kafkaConsumeFunc(b messageBus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := backendContext(c.Request.Context(), "kafka")
+		defer cancel()
+
+		// the messages read before an error are consumed all the same, so
+		// they're processed before the error is reported
+		msgs, consumeErr := b.Consume(ctx, 100)
+		processed, undecodable := 0, 0
+		for _, m := range msgs {
+			if !firstDelivery(ctx, m) {
+				continue
+			}
+			if _, err := decodeMessageValue(ctx, m.Value); err != nil {
+				releaseDelivery(ctx, m)
+				avroDecodeErrors.Add(1)
+				slog.Warn("kafka: undecodable message", "trace_id", traceIDFromContext(ctx), "error", err)
+				undecodable++
+				continue
+			}
+			processed++
+		}
+		if consumeErr != nil {
+			respondError(c, http.StatusInternalServerError, "Kafka consume error after %d messages: %v", processed, consumeErr)
+			return
+		}
+		c.String(http.StatusOK, "Kafka consumed: %d messages, %d undecodable, %d duplicates skipped",
+			processed, undecodable, len(msgs)-processed-undecodable)
+	}
+}
+
+func healthzFunc(c *gin.Context) {
+	status := "ok"
+	states := gin.H{}
+	for _, b := range []*breaker{mysqlBreaker, mongoBreaker, clickhouseBreaker} {
+		snap := b.snapshot()
+		if snap["state"] != breakerClosed.String() {
+			status = "degraded"
+		}
+		states[b.name] = snap
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status, "breakers": states})
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withoutSteps marks the named startup steps unavailable for the rest of
+// the test, as if they had been skipped.
+func withoutSteps(t *testing.T, names ...string) {
+	for _, name := range names {
+		unavailableSteps.Store(name, true)
+	}
+	t.Cleanup(func() {
+		for _, name := range names {
+			unavailableSteps.Delete(name)
+		}
+	})
+}
+
+func serve(h gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/", h)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w
+}
+
+func TestRedisFunc(t *testing.T) {
+	clock := newFakeClock()
+	store := newMemoryCache(clock)
+
+	tests := []struct {
+		name    string
+		set     string
+		ttl     time.Duration
+		advance time.Duration
+		want    string
+	}{
+		{name: "miss", want: "Redis called"},
+		{name: "hit", set: "cached", want: "Redis called: cached"},
+		{name: "hit before expiry", set: "fresh", ttl: time.Minute, advance: 59 * time.Second, want: "Redis called: fresh"},
+		{name: "expired", set: "stale", ttl: time.Minute, advance: time.Minute + time.Second, want: "Redis called"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.entries = map[string]memoryCacheEntry{}
+			if tt.set != "" {
+				if err := store.Set(context.Background(), "key", tt.set, tt.ttl); err != nil {
+					t.Fatal(err)
+				}
+			}
+			clock.Advance(tt.advance)
+			w := serve(redisFunc(store))
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Fatalf("got %d %q, want 200 %q", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestKafkaFuncs(t *testing.T) {
+	// without Redis, consumers don't deduplicate
+	withoutSteps(t, "redis")
+	b := newMemoryBus()
+
+	if w := serve(kafkaProduceFunc(b)); w.Code != http.StatusOK || w.Body.String() != "Kafka produced" {
+		t.Fatalf("produce: got %d %q", w.Code, w.Body.String())
+	}
+	if n := b.Len(); n != 3 {
+		t.Fatalf("got %d queued messages, want 3", n)
+	}
+	want := "Kafka consumed: 3 messages, 0 undecodable, 0 duplicates skipped"
+	if w := serve(kafkaConsumeFunc(b)); w.Code != http.StatusOK || w.Body.String() != want {
+		t.Fatalf("consume: got %d %q, want 200 %q", w.Code, w.Body.String(), want)
+	}
+	if n := b.Len(); n != 0 {
+		t.Fatalf("got %d queued messages after consuming, want 0", n)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/gin-gonic/gin"
+)
+
+var mcc *memcache.Client
+
+func initMemcached(ctx context.Context) error {
+	mcc = memcache.New(strings.Split(getEnv("MEMCACHED_ADDRS", "memcached:11211"), ",")...)
+	mcc.Timeout = backendTimeouts["memcached"]
+	return mcc.Ping()
+}
+
+func memcachedFunc(c *gin.Context) {
+	item, err := mcc.Get("key")
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		err = mcc.Set(&memcache.Item{
+			Key:        "key",
+			Value:      []byte(clk.Now().Format(time.RFC3339)),
+			Expiration: 60,
+		})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Memcached set error: %v", err)
+			return
+		}
+		c.String(http.StatusOK, "Memcached called")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Memcached error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "Memcached called: %s", item.Value)
+}
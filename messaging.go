@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// message is a broker-agnostic message. Headers carry the trace context
+// (traceparent) from producer to consumer.
+type message struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// messageBus is the broker behind the /kafka endpoints: Kafka normally, or
+// an in-process bus in LOCAL_MODE.
+type messageBus interface {
+	Produce(ctx context.Context, msgs ...message) error
+	// Consume returns up to max messages, waiting up to 10s (or until ctx
+	// is done) for at least one to become available.
+	Consume(ctx context.Context, max int) ([]message, error)
+	Close() error
+}
+
+var bus messageBus
+
+// localMode reports whether LOCAL_MODE is enabled, in which case in-process
+// implementations replace infrastructure that needs containers.
+func localMode() bool {
+	return getEnv("LOCAL_MODE", "false") == "true"
+}
+
+// kafkaBus talks to the partition leader of a single Kafka topic. Writes
+// rotate over connections looked up through each of the brokers, so a
+// broker going away only takes its connection with it.
+type kafkaBus struct {
+	writers *nodePool[*kafkaWriter]
+
+	// mu guards conn, whose read deadline Consume and Lag both set.
+	mu   sync.Mutex
+	conn *kafka.Conn
+}
+
+func newKafkaBus(ctx context.Context, brokers []string, topic string) (*kafkaBus, error) {
+	writers, err := newNodePool("kafka", brokers, func(addr string) (*kafkaWriter, error) {
+		return &kafkaWriter{addr: addr, topic: topic}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := &kafkaBus{writers: writers}
+	err = writers.Do(ctx, func(ctx context.Context, addr string, _ *kafkaWriter) error {
+		conn, err := kafka.DialLeader(ctx, "tcp", addr, topic, 0)
+		if err == nil {
+			b.conn = conn
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// kafkaWriter is a connection to the partition leader, dialed through one
+// broker. It redials on the next write after a failed one.
+type kafkaWriter struct {
+	addr  string
+	topic string
+
+	mu   sync.Mutex
+	conn *kafka.Conn
+}
+
+func (w *kafkaWriter) write(ctx context.Context, kmsgs []kafka.Message) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		conn, err := kafka.DialLeader(ctx, "tcp", w.addr, w.topic, 0)
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+	_ = w.conn.SetWriteDeadline(deadlineFrom(ctx, 10*time.Second))
+	n, err := w.conn.WriteMessages(kmsgs...)
+	if err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return n, err
+}
+
+func (w *kafkaWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		_ = w.conn.Close()
+	}
+}
+
+func (b *kafkaBus) Produce(ctx context.Context, msgs ...message) error {
+	kmsgs := make([]kafka.Message, 0, len(msgs))
+	for _, m := range msgs {
+		km := kafka.Message{Key: m.Key, Value: m.Value}
+		for k, v := range m.Headers {
+			km.Headers = append(km.Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		kmsgs = append(kmsgs, km)
+	}
+	return b.writers.Do(ctx, func(ctx context.Context, _ string, w *kafkaWriter) error {
+		n, err := w.write(ctx, kmsgs)
+		if err == nil {
+			kafkaCounters.produced(len(kmsgs), n)
+		}
+		return err
+	})
+}
+
+// Consume returns the messages read, along with the error that ended the
+// read or closed the batch, if any.
+func (b *kafkaBus) Consume(ctx context.Context, max int) (msgs []message, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_ = b.conn.SetReadDeadline(deadlineFrom(ctx, 10*time.Second))
+	start := clk.Now()
+	batch := b.conn.ReadBatch(10e3, 1e6) // fetch 10KB min, 1MB max
+	kafkaCounters.fetched(clk.Since(start))
+	defer func() {
+		if cerr := batch.Close(); err == nil && !endOfBatch(cerr) {
+			err = cerr
+		}
+	}()
+
+	for len(msgs) < max {
+		km, err := batch.ReadMessage()
+		if endOfBatch(err) {
+			break
+		}
+		if err != nil {
+			return msgs, err
+		}
+		m := message{Key: km.Key, Value: km.Value, Headers: map[string]string{}}
+		for _, h := range km.Headers {
+			m.Headers[h.Key] = string(h.Value)
+		}
+		msgs = append(msgs, m)
+		kafkaCounters.consumed(len(km.Key) + len(km.Value))
+	}
+	return msgs, nil
+}
+
+// endOfBatch reports whether err only means that no more messages came in
+// before the deadline.
+func endOfBatch(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// Lag returns how many messages of the partition haven't been consumed yet.
+func (b *kafkaBus) Lag() (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_ = b.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	last, err := b.conn.ReadLastOffset()
+	if err != nil {
+		return 0, err
+	}
+	offset, _ := b.conn.Offset()
+	return last - offset, nil
+}
+
+func (b *kafkaBus) Close() error {
+	b.writers.each(func(_ string, w *kafkaWriter) { w.close() })
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn.Close()
+}
+
+// memoryBus is an in-process, unbounded FIFO used in LOCAL_MODE.
+type memoryBus struct {
+	mu     sync.Mutex
+	queue  []message
+	notify chan struct{}
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{notify: make(chan struct{})}
+}
+
+func (b *memoryBus) Produce(_ context.Context, msgs ...message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue = append(b.queue, msgs...)
+	// wake up waiting consumers
+	close(b.notify)
+	b.notify = make(chan struct{})
+	return nil
+}
+
+func (b *memoryBus) Consume(ctx context.Context, max int) ([]message, error) {
+	timer := time.NewTimer(time.Until(deadlineFrom(ctx, 10*time.Second)))
+	defer timer.Stop()
+	for {
+		b.mu.Lock()
+		if len(b.queue) > 0 {
+			n := min(max, len(b.queue))
+			msgs := append([]message(nil), b.queue[:n]...)
+			b.queue = b.queue[n:]
+			b.mu.Unlock()
+			return msgs, nil
+		}
+		notify := b.notify
+		b.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Len returns the number of messages waiting to be consumed.
+func (b *memoryBus) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queue)
+}
+
+func (b *memoryBus) Close() error {
+	return nil
+}
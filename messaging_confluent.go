@@ -0,0 +1,118 @@
+//go:build confluent
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// confluentBus is the kafkaBus equivalent built on confluent-kafka-go,
+// selected with KAFKA_CLIENT=confluent. The client wraps librdkafka, so it
+// needs cgo and is only built with the confluent build tag:
+//
+//	CGO_ENABLED=1 go build -tags confluent .
+//
+// On Alpine based images add the musl tag as well.
+type confluentBus struct {
+	producer *kafka.Producer
+	consumer *kafka.Consumer
+	topic    string
+}
+
+func newConfluentBus(brokers []string, topic string) (messageBus, error) {
+	servers := strings.Join(brokers, ",")
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": servers})
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": servers,
+		"group.id":          "sample_group_confluent",
+		"auto.offset.reset": "earliest",
+	})
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+	if err = consumer.Subscribe(topic, nil); err != nil {
+		producer.Close()
+		_ = consumer.Close()
+		return nil, err
+	}
+	return &confluentBus{producer: producer, consumer: consumer, topic: topic}, nil
+}
+
+func (b *confluentBus) Produce(ctx context.Context, msgs ...message) error {
+	deliveries := make(chan kafka.Event, len(msgs))
+	for _, m := range msgs {
+		km := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &b.topic, Partition: 0},
+			Key:            m.Key,
+			Value:          m.Value,
+		}
+		for k, v := range m.Headers {
+			km.Headers = append(km.Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		if err := b.producer.Produce(km, deliveries); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for range msgs {
+		select {
+		case e := <-deliveries:
+			if km, ok := e.(*kafka.Message); ok && km.TopicPartition.Error != nil {
+				errs = append(errs, km.TopicPartition.Error)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Consume waits for a first message, then returns it along with those that
+// are already fetched, up to max.
+func (b *confluentBus) Consume(ctx context.Context, max int) ([]message, error) {
+	deadline := deadlineFrom(ctx, 10*time.Second)
+	var msgs []message
+	for len(msgs) < max {
+		// wait for the first message only, then take what's already fetched
+		timeout := time.Millisecond
+		if len(msgs) == 0 {
+			timeout = time.Until(deadline)
+			if timeout <= 0 {
+				// a negative timeout would make ReadMessage wait forever
+				return msgs, nil
+			}
+		}
+		km, err := b.consumer.ReadMessage(timeout)
+		var kerr kafka.Error
+		if errors.As(err, &kerr) && kerr.IsTimeout() {
+			return msgs, nil
+		}
+		if err != nil {
+			if len(msgs) == 0 {
+				return nil, err
+			}
+			return msgs, nil
+		}
+		m := message{Key: km.Key, Value: km.Value, Headers: map[string]string{}}
+		for _, h := range km.Headers {
+			m.Headers[h.Key] = string(h.Value)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+func (b *confluentBus) Close() error {
+	b.producer.Close()
+	return b.consumer.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !confluent
+
+package main
+
+import "errors"
+
+func newConfluentBus(brokers []string, topic string) (messageBus, error) {
+	return nil, errors.New("KAFKA_CLIENT=confluent needs a build with the confluent tag")
+}
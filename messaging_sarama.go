@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// saramaBus is the kafkaBus equivalent built on IBM/sarama, selected with
+// KAFKA_CLIENT=sarama. It produces to and consumes from partition 0 of a
+// single topic.
+type saramaBus struct {
+	client    sarama.Client
+	producer  sarama.SyncProducer
+	consumer  sarama.Consumer
+	partition sarama.PartitionConsumer
+	topic     string
+}
+
+func newSaramaBus(brokers []string, topic string) (*saramaBus, error) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Partitioner = sarama.NewManualPartitioner
+	cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	cfg.Consumer.Return.Errors = true
+
+	client, err := sarama.NewClient(brokers, cfg)
+	if err != nil {
+		return nil, err
+	}
+	b := &saramaBus{client: client, topic: topic}
+	if b.producer, err = sarama.NewSyncProducerFromClient(client); err != nil {
+		_ = b.Close()
+		return nil, err
+	}
+	if b.consumer, err = sarama.NewConsumerFromClient(client); err != nil {
+		_ = b.Close()
+		return nil, err
+	}
+	if b.partition, err = b.consumer.ConsumePartition(topic, 0, sarama.OffsetOldest); err != nil {
+		_ = b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *saramaBus) Produce(_ context.Context, msgs ...message) error {
+	pmsgs := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, m := range msgs {
+		pm := &sarama.ProducerMessage{Topic: b.topic, Partition: 0, Value: sarama.ByteEncoder(m.Value)}
+		if m.Key != nil {
+			pm.Key = sarama.ByteEncoder(m.Key)
+		}
+		for k, v := range m.Headers {
+			pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+		pmsgs = append(pmsgs, pm)
+	}
+	return b.producer.SendMessages(pmsgs)
+}
+
+// Consume waits for a first message, then returns it along with those that
+// are already buffered, up to max.
+func (b *saramaBus) Consume(ctx context.Context, max int) ([]message, error) {
+	timer := time.NewTimer(time.Until(deadlineFrom(ctx, 10*time.Second)))
+	defer timer.Stop()
+
+	var msgs []message
+	for len(msgs) < max {
+		var wait <-chan time.Time
+		if len(msgs) == 0 {
+			wait = timer.C
+		} else {
+			// stop as soon as nothing more is buffered
+			wait = time.After(0)
+		}
+		select {
+		case cm := <-b.partition.Messages():
+			m := message{Key: cm.Key, Value: cm.Value, Headers: map[string]string{}}
+			for _, h := range cm.Headers {
+				m.Headers[string(h.Key)] = string(h.Value)
+			}
+			msgs = append(msgs, m)
+		case err := <-b.partition.Errors():
+			if len(msgs) == 0 {
+				return nil, err
+			}
+			return msgs, nil
+		case <-wait:
+			return msgs, nil
+		case <-ctx.Done():
+			return msgs, ctx.Err()
+		}
+	}
+	return msgs, nil
+}
+
+func (b *saramaBus) Close() error {
+	var errs []error
+	if b.partition != nil {
+		errs = append(errs, b.partition.Close())
+	}
+	if b.consumer != nil {
+		errs = append(errs, b.consumer.Close())
+	}
+	if b.producer != nil {
+		errs = append(errs, b.producer.Close())
+	}
+	errs = append(errs, b.client.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// timeoutHeader carries the caller's timeout budget in milliseconds.
+	timeoutHeader = "X-Timeout-Ms"
+
+	// deadlineExceededKey marks requests whose work was cut short by their
+	// deadline.
+	deadlineExceededKey = "deadline_exceeded"
+)
+
+// deadlineStats counts requests by where their timeout came from, and
+// those that ran out of time.
+var deadlineStats = expvar.NewMap("deadlines")
+
+// timeoutMiddleware bounds the request context so that downstream calls made
+// with c.Request.Context() give up once the route's timeout has elapsed.
+//
+// The default timeout is REQUEST_TIMEOUT and can be overridden per route with
+// ROUTE_TIMEOUTS, e.g. "/kafka/consume=15s,/api=2s". Callers can shorten it
+// with an X-Timeout-Ms header, which the app passes on, less the time spent,
+// to the services it calls. The header must leave more than TIMEOUT_RESERVE
+// for the backend calls.
+func timeoutMiddleware() gin.HandlerFunc {
+	def := getEnvDuration("REQUEST_TIMEOUT", 10*time.Second)
+	overrides := parseRouteTimeouts(getEnv("ROUTE_TIMEOUTS", ""))
+
+	return func(c *gin.Context) {
+		timeout, ok := overrides[c.FullPath()]
+		if !ok {
+			timeout = def
+		}
+		source := "route"
+		if h := c.GetHeader(timeoutHeader); h != "" {
+			ms, err := strconv.Atoi(h)
+			if err != nil || ms < 1 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": timeoutHeader + " must be a positive number of milliseconds"})
+				return
+			}
+			// a budget within the reserve leaves no time for backend calls
+			if reserve := budgetReserve.Milliseconds(); int64(ms) <= reserve {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": timeoutHeader + " must be over " + strconv.FormatInt(reserve, 10) + " milliseconds"})
+				return
+			}
+			if d := time.Duration(ms) * time.Millisecond; d < timeout {
+				timeout, source = d, "header"
+			}
+		}
+		deadlineStats.Add(source, 1)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			deadlineStats.Add("exceeded", 1)
+			c.Set(deadlineExceededKey, true)
+			if !c.Writer.Written() {
+				respondError(c, http.StatusGatewayTimeout, "Request timed out after %s", timeout)
+			}
+		}
+	}
+}
+
+func parseRouteTimeouts(s string) map[string]time.Duration {
+	m := map[string]time.Duration{}
+	for _, kv := range strings.Split(s, ",") {
+		route, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			continue
+		}
+		if d, err := time.ParseDuration(val); err == nil {
+			m[route] = d
+		}
+	}
+	return m
+}
+
+// deadlineFrom returns the earlier of now+d and the context's deadline, for
+// APIs such as kafka.Conn that take deadlines rather than contexts.
+func deadlineFrom(ctx context.Context, d time.Duration) time.Time {
+	deadline := time.Now().Add(d)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// timeoutFromContext returns the X-Timeout-Ms value passing what's left of
+// ctx's deadline on to a downstream service, or "" if ctx has none.
+func timeoutFromContext(ctx context.Context) string {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ""
+	}
+	return strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10)
+}
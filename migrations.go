@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"expvar"
+	"log/slog"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratemysql "github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// migrationsFS holds the MySQL schema migrations, applied in version order
+// on startup. Each file holds a single statement.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// schemaVersion is the MySQL schema version after the last migration.
+var schemaVersion = expvar.NewInt("schema_version")
+
+// initMigrations applies the pending migrations one at a time, logging how
+// long each took. Instances starting together take turns through
+// golang-migrate's lock.
+func initMigrations(ctx context.Context) error {
+	src, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return err
+	}
+	conn, err := mysqldb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	drv, err := migratemysql.WithConnection(ctx, conn, &migratemysql.Config{})
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "mysql", drv)
+	if err != nil {
+		_ = drv.Close()
+		return err
+	}
+	// closes the connection only, leaving mysqldb open
+	defer m.Close()
+
+	for ctx.Err() == nil {
+		start := clk.Now()
+		err = m.Steps(1)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		version, _, _ := m.Version()
+		slog.Info("applied migration", "version", version, "duration", clk.Since(start))
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	version, _, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return nil
+	}
+	schemaVersion.Set(int64(version))
+	return err
+}
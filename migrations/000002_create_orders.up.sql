@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS orders (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	amount DECIMAL(12, 2) NOT NULL,
+	created_at DATETIME(3) NOT NULL
+)
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	topic VARCHAR(255) NOT NULL,
+	msg_key VARCHAR(255) NOT NULL,
+	payload JSON NOT NULL,
+	traceparent VARCHAR(55) NOT NULL,
+	created_at DATETIME(3) NOT NULL,
+	sent_at DATETIME(3) NULL,
+	INDEX unsent (sent_at, id)
+)
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS stock (
+	sku VARCHAR(64) PRIMARY KEY,
+	quantity INT NOT NULL
+)
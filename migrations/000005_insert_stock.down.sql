@@ -0,0 +1 @@
+DELETE FROM stock WHERE sku IN ('sku-1', 'sku-2', 'sku-3')
@@ -0,0 +1 @@
+INSERT IGNORE INTO stock (sku, quantity) VALUES ('sku-1', 1000), ('sku-2', 1000), ('sku-3', 10)
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(64) NOT NULL UNIQUE,
+	key_hash CHAR(64) NOT NULL UNIQUE,
+	rate_limit INT NOT NULL,
+	revoked_at DATETIME(3) NULL
+)
@@ -0,0 +1 @@
+DELETE FROM api_keys WHERE name IN ('free', 'pro')
@@ -0,0 +1 @@
+INSERT IGNORE INTO api_keys (name, key_hash, rate_limit) VALUES ('free', SHA2('free-demo-key', 256), 60), ('pro', SHA2('pro-demo-key', 256), 600)
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errTransferAborted = errors.New("transfer aborted on request")
+
+// mongoTxnFunc moves an amount between two account documents in a single
+// transaction. WithTransaction retries the transaction on transient errors;
+// ?abort=true makes it abort after both writes.
+func mongoTxnFunc(c *gin.Context) {
+	amount, err := strconv.ParseFloat(c.DefaultQuery("amount", "10"), 64)
+	if err != nil || amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive number"})
+		return
+	}
+	abort := c.Query("abort") == "true"
+
+	ctx, cancel := backendContext(c.Request.Context(), "mongo")
+	defer cancel()
+
+	session, err := mdb.StartSession()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Mongo session error: %v", err)
+		return
+	}
+	defer session.EndSession(ctx)
+
+	accounts := mdb.Database("sample_db").Collection("accounts")
+	upsert := options.Update().SetUpsert(true)
+	attempts := 0
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		attempts++
+		if _, err := accounts.UpdateOne(ctx, bson.D{{Key: "_id", Value: "alice"}},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "balance", Value: -amount}}}}, upsert); err != nil {
+			return nil, err
+		}
+		if _, err := accounts.UpdateOne(ctx, bson.D{{Key: "_id", Value: "bob"}},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "balance", Value: amount}}}}, upsert); err != nil {
+			return nil, err
+		}
+		if abort {
+			return nil, errTransferAborted
+		}
+		return nil, nil
+	})
+	if attempts > 1 {
+		recordEvent(ctx, "mongo", "transaction retried %d times", attempts-1)
+	}
+	if errors.Is(err, errTransferAborted) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "attempts": attempts})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Mongo transaction error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transferred": amount, "attempts": attempts})
+}
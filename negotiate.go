@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/xml"
+	"expvar"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// negotiatedFormats counts the /negotiate responses per content type.
+var negotiatedFormats = expvar.NewMap("negotiated_formats")
+
+// negotiateOffers are the formats /negotiate serves, in order of preference
+// for clients accepting any.
+var negotiateOffers = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+	binding.MIMEPROTOBUF,
+}
+
+type product struct {
+	XMLName xml.Name `json:"-" xml:"product" codec:"-"`
+	ID      int64    `json:"id" xml:"id" codec:"id"`
+	Name    string   `json:"name" xml:"name" codec:"name"`
+	Price   float64  `json:"price" xml:"price" codec:"price"`
+	Tags    []string `json:"tags" xml:"tags>tag" codec:"tags"`
+}
+
+// negotiateFunc serves the same product in the format picked from the
+// Accept header: JSON, XML, MessagePack or Protobuf (as a
+// google.protobuf.Struct).
+func negotiateFunc(c *gin.Context) {
+	p := product{ID: 42, Name: "Gopher plush", Price: 19.99, Tags: []string{"toys", "go"}}
+
+	format := c.NegotiateFormat(negotiateOffers...)
+	negotiatedFormats.Add(format, 1)
+	slog.Debug("negotiated format",
+		"trace_id", traceIDFromContext(c.Request.Context()),
+		"accept", c.GetHeader("Accept"),
+		"format", format,
+	)
+	c.Header("Vary", "Accept")
+
+	switch format {
+	case binding.MIMEJSON:
+		c.JSON(http.StatusOK, p)
+	case binding.MIMEXML, binding.MIMEXML2:
+		c.XML(http.StatusOK, p)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		c.Render(http.StatusOK, render.MsgPack{Data: p})
+	case binding.MIMEPROTOBUF:
+		tags := make([]any, len(p.Tags))
+		for i, t := range p.Tags {
+			tags[i] = t
+		}
+		msg, err := structpb.NewStruct(map[string]any{
+			"id":    p.ID,
+			"name":  p.Name,
+			"price": p.Price,
+			"tags":  tags,
+		})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Protobuf error: %v", err)
+			return
+		}
+		c.ProtoBuf(http.StatusOK, msg)
+	default:
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": "no acceptable format", "offered": negotiateOffers})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+var n4j neo4j.DriverWithContext
+
+func initNeo4j(ctx context.Context) error {
+	var err error
+	n4j, err = neo4j.NewDriverWithContext(
+		getEnv("NEO4J_URL", "neo4j://neo4j:7687"),
+		neo4j.BasicAuth(getEnv("NEO4J_USERNAME", "neo4j"), getEnv("NEO4J_PASSWORD", "password"), ""),
+	)
+	if err != nil {
+		return err
+	}
+	return n4j.VerifyConnectivity(ctx)
+}
+
+const neo4jVisitQuery = `MERGE (u:User {name: $user})
+MERGE (p:Page {path: $path})
+MERGE (u)-[:VISITED]->(p)
+WITH p
+MATCH (p)<-[:VISITED]-(v:User)
+RETURN count(v) AS visitors`
+
+func neo4jFunc(c *gin.Context) {
+	ctx, cancel := backendContext(c.Request.Context(), "neo4j")
+	defer cancel()
+
+	start := clk.Now()
+	res, err := neo4j.ExecuteQuery(ctx, n4j, neo4jVisitQuery,
+		map[string]any{
+			"user": c.DefaultQuery("user", "demo"),
+			"path": c.DefaultQuery("path", "/"),
+		},
+		neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("neo4j"),
+	)
+	slog.Debug("neo4j query",
+		"trace_id", traceIDFromContext(ctx),
+		"statement", neo4jVisitQuery,
+		"duration", clk.Since(start),
+		"error", err,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Neo4j error: %v", err)
+		return
+	}
+	visitors, _, err := neo4j.GetRecordValue[int64](res.Records[0], "visitors")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Neo4j result error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "Neo4j called: %d visitors", visitors)
+}
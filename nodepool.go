@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// nodeStats holds the per-node call metrics of all node pools, keyed by
+// "<pool>/<addr>".
+var nodeStats = expvar.NewMap("nodes")
+
+// nodePool spreads calls over the nodes of a multi-node backend in
+// rotation, skipping nodes that failed within the last cooldown and trying
+// the next node when a call fails.
+type nodePool[T any] struct {
+	name     string
+	nodes    []*poolNode[T]
+	next     atomic.Uint64
+	cooldown time.Duration
+}
+
+type poolNode[T any] struct {
+	addr     string
+	client   T
+	failedAt atomic.Int64 // unix nanos of the last failure, 0 when healthy
+
+	calls, errors, nanos expvar.Int
+}
+
+// newNodePool opens a client for each of addrs. Nodes that can't be opened
+// are left out; it fails only if none can.
+func newNodePool[T any](name string, addrs []string, open func(addr string) (T, error)) (*nodePool[T], error) {
+	p := &nodePool[T]{name: name, cooldown: getEnvDuration("NODE_COOLDOWN", 10*time.Second)}
+	var errs []error
+	for _, addr := range addrs {
+		client, err := open(addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n := &poolNode[T]{addr: addr, client: client}
+		stats := new(expvar.Map).Init()
+		stats.Set("calls", &n.calls)
+		stats.Set("errors", &n.errors)
+		stats.Set("latency_avg_ms", expvar.Func(func() any {
+			if calls := n.calls.Value(); calls > 0 {
+				return float64(n.nanos.Value()) / float64(calls) / float64(time.Millisecond)
+			}
+			return 0.0
+		}))
+		stats.Set("healthy", expvar.Func(func() any { return p.healthy(n) }))
+		nodeStats.Set(name+"/"+addr, stats)
+		p.nodes = append(p.nodes, n)
+	}
+	if len(p.nodes) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+func (p *nodePool[T]) healthy(n *poolNode[T]) bool {
+	failedAt := n.failedAt.Load()
+	return failedAt == 0 || clk.Since(time.Unix(0, failedAt)) > p.cooldown
+}
+
+// Do calls fn with the next healthy node, moving on to the following nodes
+// while fn fails. When all nodes are unhealthy they are tried anyway.
+func (p *nodePool[T]) Do(ctx context.Context, fn func(ctx context.Context, addr string, client T) error) error {
+	start := int(p.next.Add(1))
+	order := make([]*poolNode[T], 0, len(p.nodes))
+	var unhealthy []*poolNode[T]
+	for i := range p.nodes {
+		n := p.nodes[(start+i)%len(p.nodes)]
+		if p.healthy(n) {
+			order = append(order, n)
+		} else {
+			unhealthy = append(unhealthy, n)
+		}
+	}
+	order = append(order, unhealthy...)
+
+	var err error
+	for _, n := range order {
+		begin := clk.Now()
+		err = fn(ctx, n.addr, n.client)
+		elapsed := clk.Since(begin)
+		n.calls.Add(1)
+		n.nanos.Add(int64(elapsed))
+		slog.Debug("node call",
+			"trace_id", traceIDFromContext(ctx),
+			"pool", p.name,
+			"node", n.addr,
+			"duration", elapsed,
+			"error", err,
+		)
+		if err == nil {
+			n.failedAt.Store(0)
+			return nil
+		}
+		n.errors.Add(1)
+		n.failedAt.Store(clk.Now().UnixNano())
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// each calls fn with every node of the pool.
+func (p *nodePool[T]) each(fn func(addr string, client T)) {
+	for _, n := range p.nodes {
+		fn(n.addr, n.client)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// oidcStats counts logins, failed callbacks, and the calls made to the
+// provider.
+var oidcStats = expvar.NewMap("oidc")
+
+var (
+	oidcIssuer       = getEnv("OIDC_ISSUER", "http://dex:5556/dex")
+	oidcClientID     = getEnv("OIDC_CLIENT_ID", "sample-app")
+	oidcClientSecret = getEnv("OIDC_CLIENT_SECRET", "sample-app-secret")
+	oidcRedirectURL  = getEnv("OIDC_REDIRECT_URL", "http://localhost:8000/auth/callback")
+
+	// oidcClient makes the calls to the provider: discovery, key fetches
+	// and token exchanges.
+	oidcClient = &http.Client{Transport: oidcTransport{base: http.DefaultTransport}}
+)
+
+// oidcSetup is the provider, discovered on first use so that the app starts
+// without it.
+var oidcSetup struct {
+	sync.Mutex
+	config   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcConfig discovers the provider at OIDC_ISSUER, unless already done.
+func oidcConfig(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	oidcSetup.Lock()
+	defer oidcSetup.Unlock()
+	if oidcSetup.config != nil {
+		return oidcSetup.config, oidcSetup.verifier, nil
+	}
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, oidcClient), oidcIssuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	oidcSetup.config = &oauth2.Config{
+		ClientID:     oidcClientID,
+		ClientSecret: oidcClientSecret,
+		RedirectURL:  oidcRedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+	oidcSetup.verifier = provider.Verifier(&oidc.Config{ClientID: oidcClientID})
+	return oidcSetup.config, oidcSetup.verifier, nil
+}
+
+// oidcLoginFunc starts the authorization-code flow, redirecting to the
+// provider. The state, nonce and PKCE verifier wait in the session for the
+// callback.
+func oidcLoginFunc(c *gin.Context) {
+	config, _, err := oidcConfig(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "OIDC discovery error: %v", err)
+		return
+	}
+	state, nonce, verifier := randomHex(16), randomHex(16), oauth2.GenerateVerifier()
+
+	session := sessions.Default(c)
+	session.Set("oidc_state", state)
+	session.Set("oidc_nonce", nonce)
+	session.Set("oidc_verifier", verifier)
+	if err = session.Save(); err != nil {
+		respondError(c, http.StatusInternalServerError, "Session save error: %v", err)
+		return
+	}
+	c.Redirect(http.StatusFound, config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+}
+
+// oidcCallbackFunc completes the flow: it exchanges the code for tokens,
+// verifies the ID token and logs the user in with its claims.
+func oidcCallbackFunc(c *gin.Context) {
+	ctx := c.Request.Context()
+	session := sessions.Default(c)
+	state, _ := session.Get("oidc_state").(string)
+	nonce, _ := session.Get("oidc_nonce").(string)
+	verifier, _ := session.Get("oidc_verifier").(string)
+
+	fail := func(status int, format string, args ...any) {
+		oidcStats.Add("failures", 1)
+		respondError(c, status, format, args...)
+	}
+	if e := c.Query("error"); e != "" {
+		fail(http.StatusUnauthorized, "Provider error: %s: %s", e, c.Query("error_description"))
+		return
+	}
+	if state == "" || c.Query("state") != state {
+		fail(http.StatusBadRequest, "State mismatch, start again at /auth/login")
+		return
+	}
+	config, idVerifier, err := oidcConfig(ctx)
+	if err != nil {
+		fail(http.StatusBadGateway, "OIDC discovery error: %v", err)
+		return
+	}
+
+	ctx = oidc.ClientContext(ctx, oidcClient)
+	token, err := config.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		fail(http.StatusBadGateway, "Token exchange error: %v", err)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		fail(http.StatusBadGateway, "Token response has no ID token")
+		return
+	}
+	idToken, err := idVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		fail(http.StatusUnauthorized, "ID token verification error: %v", err)
+		return
+	}
+	if idToken.Nonce != nonce {
+		fail(http.StatusUnauthorized, "ID token nonce mismatch")
+		return
+	}
+	var claims struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		fail(http.StatusBadGateway, "ID token claims error: %v", err)
+		return
+	}
+
+	if err = renewSessionID(c, session); err != nil {
+		respondError(c, http.StatusInternalServerError, "Session renew error: %v", err)
+		return
+	}
+	session.Clear()
+	session.Set("oidc_subject", idToken.Subject)
+	session.Set("email", claims.Email)
+	session.Set("name", claims.Name)
+	session.Set("logged_in_at", clk.Now().UTC().Format(time.RFC3339))
+	if err = session.Save(); err != nil {
+		respondError(c, http.StatusInternalServerError, "Session save error: %v", err)
+		return
+	}
+	oidcStats.Add("logins", 1)
+	slog.Info("OIDC login",
+		"trace_id", traceIDFromContext(ctx),
+		"issuer", idToken.Issuer,
+		"subject", idToken.Subject,
+	)
+	c.JSON(http.StatusOK, gin.H{"subject": idToken.Subject, "email": claims.Email, "name": claims.Name})
+}
+
+// oidcTransport propagates the trace context of a request's context to the
+// provider, and logs and counts the calls.
+type oidcTransport struct {
+	base http.RoundTripper
+}
+
+func (t oidcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if tp := traceparentFromContext(ctx); tp != "" {
+		req = req.Clone(ctx)
+		req.Header.Set("traceparent", tp)
+	}
+	start := clk.Now()
+	resp, err := t.base.RoundTrip(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	oidcStats.Add("http_calls", 1)
+	slog.Debug("OIDC provider call",
+		"trace_id", traceIDFromContext(ctx),
+		"method", req.Method,
+		"url", req.URL.Redacted(),
+		"status", status,
+		"duration", clk.Since(start),
+		"error", err,
+	)
+	return resp, err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The transactional outbox: an order and the event announcing it are
+// written in one MySQL transaction, and a relay publishes the event to
+// Kafka afterwards. The event is published if and only if the order is
+// stored, without a distributed transaction.
+
+var outboxPublished = expvar.NewInt("outbox_published")
+
+// createOutboxOrderFunc stores an order in MySQL along with its
+// order_created event in the outbox.
+func createOutboxOrderFunc(c *gin.Context) {
+	var o Order
+	if !bindJSON(c, &o) {
+		return
+	}
+	ctx, cancel := backendContext(c.Request.Context(), "mysql")
+	defer cancel()
+
+	o.Status = "created"
+	o.CreatedAt = clk.Now().UTC().Truncate(time.Millisecond)
+	tx, err := mysqldb.BeginTx(ctx, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "MySQL begin error: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, commented(ctx, "INSERT INTO orders (user_id, amount, created_at) VALUES (?, ?, ?)"),
+		o.UserID, o.Amount, o.CreatedAt)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Create order error: %v", err)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Create order error: %v", err)
+		return
+	}
+	o.ID = strconv.FormatInt(id, 10)
+	payload, err := json.Marshal(orderChange{Operation: "order_created", Order: o})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Encode event error: %v", err)
+		return
+	}
+	_, err = tx.ExecContext(ctx, commented(ctx, "INSERT INTO outbox (topic, msg_key, payload, traceparent, created_at) VALUES (?, ?, ?, ?, ?)"),
+		kafkaTopicName, o.ID, payload, traceparentFromContext(ctx), o.CreatedAt)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Write outbox error: %v", err)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		respondError(c, http.StatusInternalServerError, "MySQL commit error: %v", err)
+		return
+	}
+	c.JSON(http.StatusCreated, o)
+}
+
+// runOutboxRelay publishes unsent outbox entries every
+// OUTBOX_POLL_INTERVAL until ctx is done. Entries are published at least
+// once; consumers deduplicate them by their outbox ID.
+func runOutboxRelay(ctx context.Context) {
+	if !stepAvailable("migrations") {
+		return
+	}
+	interval := getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	for ctx.Err() == nil {
+		n, err := relayOutbox(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("outbox: relaying failed", "error", err)
+		}
+		if n == 0 || err != nil {
+			sleepCtx(ctx, interval)
+		}
+	}
+}
+
+// relayOutbox publishes a batch of unsent entries and marks them sent. The
+// rows stay locked until then, so concurrent relays of other instances skip
+// them rather than publish them twice.
+func relayOutbox(ctx context.Context) (int, error) {
+	ctx, cancel := backendContext(ctx, "kafka")
+	defer cancel()
+
+	tx, err := mysqldb.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, msg_key, payload, traceparent FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT 100 FOR UPDATE SKIP LOCKED")
+	if err != nil {
+		return 0, err
+	}
+	var (
+		ids  []any
+		msgs []message
+	)
+	for rows.Next() {
+		var (
+			id               int64
+			key, traceparent string
+			payload          []byte
+		)
+		if err = rows.Scan(&id, &key, &payload, &traceparent); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		msgs = append(msgs, message{
+			Key:   []byte(key),
+			Value: payload,
+			Headers: map[string]string{
+				messageIDHeader: "outbox-" + strconv.FormatInt(id, 10),
+				"traceparent":   traceparent,
+			},
+		})
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+
+	if err = bus.Produce(ctx, msgs...); err != nil {
+		return 0, err
+	}
+	query := "UPDATE outbox SET sent_at = ? WHERE id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	if _, err = tx.ExecContext(ctx, query, append([]any{clk.Now().UTC()}, ids...)...); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	outboxPublished.Add(int64(len(msgs)))
+	return len(msgs), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxPayloadKB      = 100 * 1024
+	maxPayloadDelayMs = 60_000
+	payloadChunkSize  = 16 * 1024
+)
+
+// payloadChunk is the repeating content payloads are made of.
+var payloadChunk = bytes.Repeat([]byte("0123456789abcdef"), payloadChunkSize/16)
+
+// payloadFunc returns a generated payload of ?size_kb= kilobytes after
+// waiting ?delay_ms=. With ?chunked=true the payload is streamed in
+// flushed chunks instead of with a Content-Length.
+func payloadFunc(c *gin.Context) {
+	sizeKB, err := strconv.Atoi(c.DefaultQuery("size_kb", "1"))
+	if err != nil || sizeKB < 0 || sizeKB > maxPayloadKB {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size_kb must be between 0 and " + strconv.Itoa(maxPayloadKB)})
+		return
+	}
+	delayMs, err := strconv.Atoi(c.DefaultQuery("delay_ms", "0"))
+	if err != nil || delayMs < 0 || delayMs > maxPayloadDelayMs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delay_ms must be between 0 and " + strconv.Itoa(maxPayloadDelayMs)})
+		return
+	}
+	chunked := c.Query("chunked") == "true"
+
+	ctx := c.Request.Context()
+	sleepCtx(ctx, time.Duration(delayMs)*time.Millisecond)
+	if ctx.Err() != nil {
+		return
+	}
+
+	size := sizeKB * 1024
+	c.Header("Content-Type", "application/octet-stream")
+	if !chunked {
+		c.Header("Content-Length", strconv.Itoa(size))
+	}
+	c.Status(http.StatusOK)
+	for written := 0; written < size; {
+		n := min(payloadChunkSize, size-written)
+		if _, err = c.Writer.Write(payloadChunk[:n]); err != nil {
+			return
+		}
+		written += n
+		if chunked {
+			c.Writer.Flush()
+		}
+	}
+}
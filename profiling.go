@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http/pprof"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pprofFunc serves the runtime profiles under /admin/pprof/, e.g.
+// /admin/pprof/goroutine?debug=1 or /admin/pprof/profile?seconds=10.
+// Profiles expose the app's internals and cost CPU to take, so they're
+// behind the admin token.
+func pprofFunc(c *gin.Context) {
+	switch c.Param("name") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	case "", "/":
+		pprof.Index(c.Writer, c.Request)
+	default:
+		// pprof.Index only finds the profile's name under /debug/pprof/
+		pprof.Handler(strings.TrimPrefix(c.Param("name"), "/")).ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// The HTTP server speaks HTTP/1.1 and, over TLS, HTTP/2. H2C=true adds
+// HTTP/2 without TLS ("h2c", prior knowledge or upgrade), and HTTP3=true
+// adds HTTP/3 over QUIC on UDP HTTP3_ADDR, which needs TLS. The same
+// handlers and middlewares serve every protocol version.
+
+// httpProtocols counts requests per protocol version.
+var httpProtocols = expvar.NewMap("http_protocols")
+
+// http3Srv is the HTTP/3 server, if enabled.
+var http3Srv *http3.Server
+
+// withH2C returns handler serving h2c as well if H2C is set and the server
+// doesn't use TLS, or handler itself otherwise.
+func withH2C(handler http.Handler, tlsConfig *tls.Config) http.Handler {
+	if getEnv("H2C", "false") != "true" {
+		return handler
+	}
+	if tlsConfig != nil {
+		slog.Warn("H2C is ignored over TLS, where HTTP/2 is negotiated")
+		return handler
+	}
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// serveHTTP3 starts the HTTP/3 server on HTTP3_ADDR if HTTP3 is set, and
+// returns it, or nil if it's not enabled.
+func serveHTTP3(upg *upgrader, handler http.Handler, tlsConfig *tls.Config) (*http3.Server, error) {
+	if getEnv("HTTP3", "false") != "true" {
+		return nil, nil
+	}
+	if tlsConfig == nil {
+		return nil, errors.New("HTTP3 needs TLS, set TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	addr := getEnv("HTTP3_ADDR", ":8000")
+	conn, err := upg.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig.Clone()),
+	}
+	http3Srv = srv
+	go func() {
+		slog.Info("HTTP/3 server started", "addr", addr)
+		if err := srv.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP/3 server failed", "error", err)
+		}
+	}()
+	return srv, nil
+}
+
+// stopHTTP3 shuts the HTTP/3 server down, if it's running.
+func stopHTTP3(srv *http3.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		_ = srv.Close()
+	}
+}
+
+// protocolMiddleware counts requests per protocol version and, when HTTP/3
+// is enabled, advertises it to HTTP/1.1 and HTTP/2 clients with an Alt-Svc
+// header.
+func protocolMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		httpProtocols.Add(c.Request.Proto, 1)
+		if http3Srv != nil && c.Request.ProtoMajor < 3 {
+			_ = http3Srv.SetQUICHeaders(c.Writer.Header())
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const pubsubChannel = "sample_channel"
+
+var pubsubReceived = expvar.NewInt("pubsub_received")
+
+// pubsubMessage is the payload published on pubsubChannel. Redis pub/sub
+// has no headers, so the publisher's trace context travels in the payload.
+type pubsubMessage struct {
+	Traceparent string    `json:"traceparent"`
+	Body        string    `json:"body"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+func redisPublishFunc(c *gin.Context) {
+	payload, _ := json.Marshal(pubsubMessage{
+		Traceparent: traceparentFromContext(c.Request.Context()),
+		Body:        c.DefaultQuery("message", "hello"),
+		SentAt:      clk.Now(),
+	})
+	receivers, err := rdb.Publish(c.Request.Context(), pubsubChannel, payload).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis publish error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "Redis published to %d subscribers", receivers)
+}
+
+// runRedisSubscriber processes messages published on pubsubChannel until
+// ctx is done. Each message is handled in a trace of its own that records
+// the publisher's trace as its link.
+func runRedisSubscriber(ctx context.Context) {
+	if !stepAvailable("redis") {
+		return
+	}
+	sub := rdb.Subscribe(ctx, pubsubChannel)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-sub.Channel():
+			if !ok {
+				return
+			}
+			var m pubsubMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				slog.Warn("pubsub: malformed message", "error", err)
+				continue
+			}
+			pubsubReceived.Add(1)
+			slog.Info("pubsub: message received",
+				"trace_id", randomHex(16),
+				"link_trace_id", parseTraceparent(m.Traceparent),
+				"body", m.Body,
+				"latency", clk.Since(m.SentAt),
+			)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+var quotaExhausted = expvar.NewInt("quota_exhausted")
+
+// quotaLimit is the number of requests an API key may make per UTC day.
+var quotaLimit = int64(getEnvInt("QUOTA_DAILY_LIMIT", 1000))
+
+// quotaKey returns the Redis counter for the named API key on the day of t.
+func quotaKey(name string, t time.Time) string {
+	return "quota:" + name + ":" + t.UTC().Format(time.DateOnly)
+}
+
+// quotaReset returns how long until the daily quotas reset.
+func quotaReset(t time.Time) time.Duration {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(t)
+}
+
+// quotaMiddleware enforces the daily quota of requests authenticated by
+// apiKeyMiddleware with an atomic Redis counter per key name and day. If
+// Redis is unavailable, requests are let through.
+func quotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.GetString(apiKeyNameKey)
+		// checking the quota doesn't use it up
+		if name == "" || c.FullPath() == "/quota" || !stepAvailable("redis") {
+			c.Next()
+			return
+		}
+
+		now := clk.Now()
+		used, err := incrQuota(c.Request.Context(), name, now)
+		if err != nil {
+			slog.Warn("quota check failed", "api_key", name, "error", err)
+			c.Next()
+			return
+		}
+		setQuotaHeaders(c, used, now)
+		if used > quotaLimit {
+			quotaExhausted.Add(1)
+			if used == quotaLimit+1 {
+				recordEvent(c.Request.Context(), "quota_exhausted", "API key %s exhausted its daily quota", name)
+			}
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "daily quota exhausted"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func incrQuota(ctx context.Context, name string, now time.Time) (int64, error) {
+	ctx, cancel := backendContext(ctx, "redis")
+	defer cancel()
+	key := quotaKey(name, now)
+	pipe := rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, quotaReset(now)+time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func setQuotaHeaders(c *gin.Context, used int64, now time.Time) {
+	c.Header("X-Quota-Limit", strconv.FormatInt(quotaLimit, 10))
+	c.Header("X-Quota-Remaining", strconv.FormatInt(max(quotaLimit-used, 0), 10))
+	c.Header("X-Quota-Reset", strconv.Itoa(int(quotaReset(now).Seconds())))
+}
+
+// quotaFunc reports the caller's quota usage for today.
+func quotaFunc(c *gin.Context) {
+	name := c.GetString(apiKeyNameKey)
+	if name == "" {
+		c.String(http.StatusBadRequest, apiKeyHeader+" header is required")
+		return
+	}
+	now := clk.Now()
+	ctx, cancel := backendContext(c.Request.Context(), "redis")
+	defer cancel()
+	used, err := rdb.Get(ctx, quotaKey(name, now)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		respondError(c, http.StatusInternalServerError, "Redis error: %v", err)
+		return
+	}
+	setQuotaHeaders(c, used, now)
+	c.JSON(http.StatusOK, gin.H{
+		"api_key":   name,
+		"limit":     quotaLimit,
+		"used":      used,
+		"remaining": max(quotaLimit-used, 0),
+		"resets_in": quotaReset(now).Round(time.Second).String(),
+	})
+}
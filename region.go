@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// region is the simulated region this instance runs in, e.g. us-east.
+// Running two instances with different REGION values and PEER_URL pointing
+// at each other simulates a geo-distributed deployment.
+var region = getEnv("REGION", "")
+
+// regionLatency is added to every call made to the peer instance, standing
+// in for the network latency between regions.
+var regionLatency = getEnvDuration("REGION_LATENCY", 80*time.Millisecond)
+
+func regionFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"region": region})
+}
+
+// regionCallFunc calls the peer instance in the other region, paying the
+// simulated inter-region latency.
+func regionCallFunc(c *gin.Context) {
+	peer := getEnv("PEER_URL", "")
+	if peer == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "no peer region configured, set PEER_URL"})
+		return
+	}
+	ctx := c.Request.Context()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/region", nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Peer request error: %v", err)
+		return
+	}
+	setPropagationHeaders(ctx, req)
+
+	start := clk.Now()
+	sleepCtx(ctx, regionLatency)
+	if t := timeoutFromContext(ctx); t != "" {
+		req.Header.Set(timeoutHeader, t)
+	}
+	resp, err := hcl.Do(req)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, "Peer call error: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Region string `json:"region"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		respondError(c, http.StatusBadGateway, "Peer response error: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"region":      region,
+		"peer_region": body.Region,
+		"latency":     clk.Since(start).String(),
+	})
+}
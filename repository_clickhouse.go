@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+)
+
+type clickhouseEventRepository struct {
+	conn    driver.Conn
+	writers *nodePool[driver.Conn]
+}
+
+func (r *clickhouseEventRepository) migrate(ctx context.Context) error {
+	return r.conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS events (
+		id UUID,
+		kind LowCardinality(String),
+		user_id Int64,
+		payload String,
+		created_at DateTime64(3)
+	) ENGINE = MergeTree ORDER BY (kind, created_at)`)
+}
+
+func (r *clickhouseEventRepository) InsertEvent(ctx context.Context, e *Event) error {
+	e.ID = uuid.NewString()
+	e.CreatedAt = clk.Now().UTC().Truncate(time.Millisecond)
+
+	return r.writers.Do(ctx, func(ctx context.Context, _ string, conn driver.Conn) error {
+		batch, err := conn.PrepareBatch(ctx, "INSERT INTO events")
+		if err != nil {
+			return err
+		}
+		if err = batch.Append(uuid.MustParse(e.ID), e.Kind, e.UserID, e.Payload, e.CreatedAt); err != nil {
+			_ = batch.Abort()
+			return err
+		}
+		return batch.Send()
+	})
+}
+
+func (r *clickhouseEventRepository) CountEventsByKind(ctx context.Context, since time.Time) (map[string]uint64, error) {
+	rows, err := r.conn.Query(ctx,
+		commented(ctx, "SELECT kind, count() FROM events WHERE created_at >= ? GROUP BY kind"), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]uint64{}
+	for rows.Next() {
+		var (
+			kind  string
+			count uint64
+		)
+		if err = rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+		counts[kind] = count
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// gormUserRepository stores users in the same MySQL table as
+// mysqlUserRepository, going through GORM instead of raw database/sql.
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+func newGormUserRepository(db *sql.DB) (*gormUserRepository, error) {
+	gdb, err := gorm.Open(mysql.New(mysql.Config{Conn: db}), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return &gormUserRepository{db: gdb}, nil
+}
+
+func (r *gormUserRepository) CreateUser(ctx context.Context, u *User) error {
+	u.CreatedAt = clk.Now().UTC().Truncate(time.Millisecond)
+	return r.db.WithContext(ctx).Create(u).Error
+}
+
+func (r *gormUserRepository) GetUser(ctx context.Context, id int64) (*User, error) {
+	var u User
+	err := r.db.WithContext(ctx).First(&u, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *gormUserRepository) ListUsers(ctx context.Context, limit int) ([]User, error) {
+	users := []User{}
+	err := r.db.WithContext(ctx).Order("id DESC").Limit(limit).Find(&users).Error
+	return users, err
+}
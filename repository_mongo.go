@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoOrderRepository struct {
+	coll *mongo.Collection
+}
+
+// orderDocument is the Mongo representation of an Order.
+type orderDocument struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    int64              `bson:"user_id"`
+	Amount    float64            `bson:"amount"`
+	Status    string             `bson:"status"`
+	CreatedAt time.Time          `bson:"created_at"`
+	// Traceparent links the document to the request that wrote it.
+	Traceparent string `bson:"traceparent,omitempty"`
+}
+
+func (d orderDocument) order() Order {
+	return Order{
+		ID:        d.ID.Hex(),
+		UserID:    d.UserID,
+		Amount:    d.Amount,
+		Status:    d.Status,
+		CreatedAt: d.CreatedAt,
+	}
+}
+
+func newMongoOrderRepository(db *mongo.Database) *mongoOrderRepository {
+	return &mongoOrderRepository{coll: db.Collection("orders")}
+}
+
+func (r *mongoOrderRepository) migrate(ctx context.Context) error {
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+func (r *mongoOrderRepository) CreateOrder(ctx context.Context, o *Order) error {
+	o.CreatedAt = clk.Now().UTC().Truncate(time.Millisecond)
+	if o.Status == "" {
+		o.Status = "created"
+	}
+	res, err := r.coll.InsertOne(ctx, orderDocument{
+		UserID:      o.UserID,
+		Amount:      o.Amount,
+		Status:      o.Status,
+		CreatedAt:   o.CreatedAt,
+		Traceparent: traceparentFromContext(ctx),
+	})
+	if err != nil {
+		return err
+	}
+	o.ID = res.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (r *mongoOrderRepository) GetOrder(ctx context.Context, id string) (*Order, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errNotFound
+	}
+	var doc orderDocument
+	err = r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: oid}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	o := doc.order()
+	return &o, nil
+}
+
+func (r *mongoOrderRepository) ListOrdersByUser(ctx context.Context, userID int64) ([]Order, error) {
+	cur, err := r.coll.Find(ctx,
+		bson.D{{Key: "user_id", Value: userID}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(100),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	orders := []Order{}
+	for cur.Next(ctx) {
+		var doc orderDocument
+		if err = cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		orders = append(orders, doc.order())
+	}
+	return orders, cur.Err()
+}
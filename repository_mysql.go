@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type mysqlUserRepository struct {
+	db *sql.DB
+}
+
+func (r *mysqlUserRepository) CreateUser(ctx context.Context, u *User) error {
+	u.CreatedAt = clk.Now().UTC().Truncate(time.Millisecond)
+	res, err := r.db.ExecContext(ctx,
+		commented(ctx, "INSERT INTO users (name, email, created_at) VALUES (?, ?, ?)"),
+		u.Name, u.Email, u.CreatedAt)
+	if err != nil {
+		return err
+	}
+	u.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *mysqlUserRepository) GetUser(ctx context.Context, id int64) (*User, error) {
+	var u User
+	query := commented(ctx, "SELECT id, name, email, created_at FROM users WHERE id = ?")
+	start := clk.Now()
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt)
+	explainIfSlow(ctx, r.db, query, start, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *mysqlUserRepository) ListUsers(ctx context.Context, limit int) ([]User, error) {
+	query := commented(ctx, "SELECT id, name, email, created_at FROM users ORDER BY id DESC LIMIT ?")
+	start := clk.Now()
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	defer explainIfSlow(ctx, r.db, query, start, limit)
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
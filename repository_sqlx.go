@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// sqlxUserRepository stores users in the same MySQL table as
+// mysqlUserRepository, scanning rows into structs with sqlx.
+type sqlxUserRepository struct {
+	db *sqlx.DB
+}
+
+func (r *sqlxUserRepository) CreateUser(ctx context.Context, u *User) error {
+	u.CreatedAt = clk.Now().UTC().Truncate(time.Millisecond)
+	res, err := r.db.NamedExecContext(ctx,
+		commented(ctx, "INSERT INTO users (name, email, created_at) VALUES (:name, :email, :created_at)"), u)
+	if err != nil {
+		return err
+	}
+	u.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqlxUserRepository) GetUser(ctx context.Context, id int64) (*User, error) {
+	var u User
+	err := r.db.GetContext(ctx, &u, commented(ctx, "SELECT id, name, email, created_at FROM users WHERE id = ?"), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *sqlxUserRepository) ListUsers(ctx context.Context, limit int) ([]User, error) {
+	users := []User{}
+	err := r.db.SelectContext(ctx, &users,
+		commented(ctx, "SELECT id, name, email, created_at FROM users ORDER BY id DESC LIMIT ?"), limit)
+	return users, err
+}
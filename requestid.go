@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds the client-supplied request IDs that are accepted.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// requestIDMiddleware takes the request ID from an X-Request-ID header, as
+// set by load balancers and API clients, or makes one up, and stores it in
+// the request context next to the trace ID. It's returned in the
+// X-Request-ID response header, and logged and reported along with the
+// trace ID, so that a request can be looked up by either.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = randomHex(16)
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID reports whether id is safe to echo back and log: short
+// and made of printable ASCII.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDFromContext returns the ID of the request ctx belongs to, if
+// any.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
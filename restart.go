@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cloudflare/tableflip"
+)
+
+var upgrades = expvar.NewInt("upgrades")
+
+// upgrader hands the listening socket over to a freshly started copy of the
+// binary on SIGHUP, so the app can be restarted without refusing
+// connections. It is enabled with GRACEFUL_RESTART=true; otherwise it falls
+// back to a plain listener.
+type upgrader struct {
+	upg *tableflip.Upgrader
+}
+
+func newUpgrader() (*upgrader, error) {
+	if getEnv("GRACEFUL_RESTART", "false") != "true" {
+		return &upgrader{}, nil
+	}
+	upg, err := tableflip.New(tableflip.Options{PIDFile: getEnv("PID_FILE", "")})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP)
+		for range sig {
+			slog.Info("SIGHUP received, upgrading", "pid", os.Getpid())
+			if err := upg.Upgrade(); err != nil {
+				slog.Error("upgrade failed", "error", err)
+				continue
+			}
+			upgrades.Add(1)
+			recordEvent(context.Background(), "upgrade", "process %d handed over its listeners", os.Getpid())
+		}
+	}()
+	if upg.HasParent() {
+		recordEvent(context.Background(), "upgrade", "process %d took over listeners from its parent", os.Getpid())
+	}
+	return &upgrader{upg: upg}, nil
+}
+
+// Listen returns a listener inherited from the parent process if there is
+// one, or a new listener otherwise.
+func (u *upgrader) Listen(network, addr string) (net.Listener, error) {
+	if u.upg == nil {
+		return net.Listen(network, addr)
+	}
+	return u.upg.Listen(network, addr)
+}
+
+// ListenPacket is like Listen for packet-oriented networks such as UDP.
+func (u *upgrader) ListenPacket(network, addr string) (net.PacketConn, error) {
+	if u.upg == nil {
+		return net.ListenPacket(network, addr)
+	}
+	return u.upg.ListenPacket(network, addr)
+}
+
+// Ready signals the parent process, if any, that it can start draining.
+func (u *upgrader) Ready() error {
+	if u.upg == nil {
+		return nil
+	}
+	return u.upg.Ready()
+}
+
+// Exit is closed once a new process has taken over the listeners. It is nil,
+// and so never ready, when graceful restarts are disabled.
+func (u *upgrader) Exit() <-chan struct{} {
+	if u.upg == nil {
+		return nil
+	}
+	return u.upg.Exit()
+}
+
+func (u *upgrader) Stop() {
+	if u.upg != nil {
+		u.upg.Stop()
+	}
+}
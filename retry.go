@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// retryStats counts, per target, the calls made through retry, the retries
+// and the calls that failed after all attempts.
+var retryStats = expvar.NewMap("retries")
+
+var (
+	// redisRetry retries the /redis handler's reads, but not misses.
+	redisRetry = newRetryPolicy("redis", func(err error) bool {
+		return !errors.Is(err, errCacheMiss) && notCancelled(err)
+	})
+
+	// apiRetry retries the /api handler's calls on network errors and
+	// 502, 503 and 504 responses.
+	apiRetry = newRetryPolicy("api", notCancelled)
+)
+
+// retryPolicy says how often and how patiently to retry calls to a target.
+type retryPolicy struct {
+	name       string
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	jitter     float64
+
+	// retryable reports whether a call failing with err is worth retrying.
+	retryable func(err error) bool
+}
+
+// newRetryPolicy returns the retry policy of target, from
+// <TARGET>_RETRY_ATTEMPTS, _RETRY_BACKOFF, _RETRY_MAX_BACKOFF and
+// _RETRY_JITTER, defaulting to RETRY_ATTEMPTS (3), RETRY_BACKOFF (50ms),
+// RETRY_MAX_BACKOFF (1s) and RETRY_JITTER (0.5, the fraction of each
+// backoff that's randomized).
+func newRetryPolicy(target string, retryable func(err error) bool) retryPolicy {
+	prefix := strings.ToUpper(target) + "_"
+	return retryPolicy{
+		name:       target,
+		attempts:   max(getEnvInt(prefix+"RETRY_ATTEMPTS", getEnvInt("RETRY_ATTEMPTS", 3)), 1),
+		backoff:    getEnvDuration(prefix+"RETRY_BACKOFF", getEnvDuration("RETRY_BACKOFF", 50*time.Millisecond)),
+		maxBackoff: getEnvDuration(prefix+"RETRY_MAX_BACKOFF", getEnvDuration("RETRY_MAX_BACKOFF", time.Second)),
+		jitter:     min(max(getEnvFloat(prefix+"RETRY_JITTER", getEnvFloat("RETRY_JITTER", 0.5)), 0), 1),
+		retryable:  retryable,
+	}
+}
+
+// retry calls fn until it succeeds, fails with an error that isn't
+// retryable, or the policy's attempts are used up, backing off
+// exponentially between attempts. It gives up early if ctx is done or its
+// deadline would pass during the backoff. Each failed attempt is logged
+// with the trace ID.
+func retry[T any](ctx context.Context, p retryPolicy, fn func(ctx context.Context) (T, error)) (T, error) {
+	retryStats.Add(p.name+"_calls", 1)
+	for attempt := 1; ; attempt++ {
+		v, err := fn(ctx)
+		if err == nil || (p.retryable != nil && !p.retryable(err)) {
+			return v, err
+		}
+		if attempt == p.attempts || ctx.Err() != nil {
+			retryStats.Add(p.name+"_exhausted", 1)
+			return v, err
+		}
+		wait := p.backoffFor(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			retryStats.Add(p.name+"_exhausted", 1)
+			return v, err
+		}
+		slog.Debug("retrying",
+			"trace_id", traceIDFromContext(ctx),
+			"target", p.name,
+			"attempt", attempt,
+			"backoff", wait,
+			"error", err,
+		)
+		retryStats.Add(p.name+"_retries", 1)
+		sleepCtx(ctx, wait)
+	}
+}
+
+// backoffFor returns how long to wait after the given failed attempt.
+func (p retryPolicy) backoffFor(attempt int) time.Duration {
+	d := min(p.backoff<<(attempt-1), p.maxBackoff)
+	return d - time.Duration(p.jitter*rand.Float64()*float64(d))
+}
+
+// notCancelled reports whether err isn't a cancellation or timeout of the
+// caller's context, which retrying can't help with.
+func notCancelled(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
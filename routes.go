@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// instrumentationMiddlewares are the middlewares every route is expected to
+// run behind: tracing, logging and metrics.
+var instrumentationMiddlewares = []string{
+	"traceContextMiddleware",
+	"traceLogMiddleware",
+	"statsMiddleware",
+}
+
+// registeredRoute is a route as registered through a routeGroup, with the
+// middlewares in front of its handler.
+type registeredRoute struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Group       string   `json:"group"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+	Missing     []string `json:"missing,omitempty"`
+}
+
+var registeredRoutes struct {
+	sync.Mutex
+	routes []registeredRoute
+}
+
+// routeGroup wraps a gin.RouterGroup and records the handler chain of every
+// route registered through it, so that routes added without the
+// instrumentation middlewares show up in /debug/routes.
+type routeGroup struct {
+	*gin.RouterGroup
+}
+
+func trackRoutes(g *gin.RouterGroup) routeGroup {
+	return routeGroup{g}
+}
+
+func (g routeGroup) Group(relativePath string, handlers ...gin.HandlerFunc) routeGroup {
+	return routeGroup{g.RouterGroup.Group(relativePath, handlers...)}
+}
+
+func (g routeGroup) GET(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (g routeGroup) POST(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (g routeGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+func (g routeGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
+func (g routeGroup) Handle(method, relativePath string, handlers ...gin.HandlerFunc) {
+	g.RouterGroup.Handle(method, relativePath, handlers...)
+
+	chain := append(slices.Clone(g.Handlers), handlers...)
+	r := registeredRoute{
+		Method:  method,
+		Path:    joinRoutePath(g.BasePath(), relativePath),
+		Group:   g.BasePath(),
+		Handler: funcName(chain[len(chain)-1]),
+	}
+	for _, h := range chain[:len(chain)-1] {
+		r.Middlewares = append(r.Middlewares, funcName(h))
+	}
+	for _, mw := range instrumentationMiddlewares {
+		if !slices.ContainsFunc(r.Middlewares, func(name string) bool {
+			return name == mw || strings.HasSuffix(name, "."+mw)
+		}) {
+			r.Missing = append(r.Missing, mw)
+		}
+	}
+	if len(r.Missing) > 0 {
+		slog.Warn("route registered without instrumentation", "method", r.Method, "path", r.Path, "missing", r.Missing)
+	}
+
+	registeredRoutes.Lock()
+	defer registeredRoutes.Unlock()
+	registeredRoutes.routes = append(registeredRoutes.routes, r)
+}
+
+func joinRoutePath(base, relative string) string {
+	if relative == "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(relative, "/")
+}
+
+// funcName returns a short name of h: the function it was created by for
+// closures, e.g. "statsMiddleware" for the closure returned by it, and
+// "gin.LoggerWithConfig" for gin's logger.
+func funcName(h gin.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimPrefix(name, "main.")
+	if i := strings.Index(name, ".func"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// debugRoutesFunc lists the registered routes and the groups with routes
+// missing any of the instrumentation middlewares.
+func debugRoutesFunc(c *gin.Context) {
+	registeredRoutes.Lock()
+	routes := slices.Clone(registeredRoutes.routes)
+	registeredRoutes.Unlock()
+
+	uninstrumented := []string{}
+	for _, r := range routes {
+		if len(r.Missing) > 0 && !slices.Contains(uninstrumented, r.Group) {
+			uninstrumented = append(uninstrumented, r.Group)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"routes":                routes,
+		"uninstrumented_groups": uninstrumented,
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"expvar"
+	"math"
+	"net/http"
+	"runtime/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runtimeSamples are the Go runtime metrics reported beyond the memstats
+// published by expvar.
+var runtimeSamples = []metrics.Sample{
+	{Name: "/sched/latencies:seconds"},
+	{Name: "/sched/goroutines:goroutines"},
+	{Name: "/sched/gomaxprocs:threads"},
+	{Name: "/cgo/go-to-c-calls:calls"},
+	{Name: "/gc/heap/live:bytes"},
+	{Name: "/gc/cycles/total:gc-cycles"},
+	{Name: "/sched/pauses/total/gc:seconds"},
+}
+
+func init() {
+	expvar.Publish("runtime", expvar.Func(func() any { return readRuntimeMetrics() }))
+}
+
+type runtimeSnapshot struct {
+	Goroutines        uint64  `json:"goroutines"`
+	GOMAXPROCS        uint64  `json:"gomaxprocs"`
+	CgoCalls          uint64  `json:"cgo_calls"`
+	SchedLatencyCount uint64  `json:"sched_latency_count"`
+	SchedLatencyP50Ms float64 `json:"sched_latency_p50_ms"`
+	SchedLatencyP99Ms float64 `json:"sched_latency_p99_ms"`
+	SchedLatencyMaxMs float64 `json:"sched_latency_max_ms"`
+	HeapLiveBytes     uint64  `json:"heap_live_bytes"`
+	GCCycles          uint64  `json:"gc_cycles"`
+	GCPauseP99Ms      float64 `json:"gc_pause_p99_ms"`
+	GCPauseMaxMs      float64 `json:"gc_pause_max_ms"`
+}
+
+func readRuntimeMetrics() runtimeSnapshot {
+	samples := make([]metrics.Sample, len(runtimeSamples))
+	copy(samples, runtimeSamples)
+	metrics.Read(samples)
+
+	var s runtimeSnapshot
+	for _, sample := range samples {
+		switch sample.Name {
+		case "/sched/latencies:seconds":
+			h := sample.Value.Float64Histogram()
+			s.SchedLatencyP50Ms = histogramQuantile(h, 0.5) * 1000
+			s.SchedLatencyP99Ms = histogramQuantile(h, 0.99) * 1000
+			s.SchedLatencyMaxMs = histogramQuantile(h, 1) * 1000
+			for _, n := range h.Counts {
+				s.SchedLatencyCount += n
+			}
+		case "/sched/goroutines:goroutines":
+			s.Goroutines = sample.Value.Uint64()
+		case "/sched/gomaxprocs:threads":
+			s.GOMAXPROCS = sample.Value.Uint64()
+		case "/cgo/go-to-c-calls:calls":
+			s.CgoCalls = sample.Value.Uint64()
+		case "/gc/heap/live:bytes":
+			s.HeapLiveBytes = sample.Value.Uint64()
+		case "/gc/cycles/total:gc-cycles":
+			s.GCCycles = sample.Value.Uint64()
+		case "/sched/pauses/total/gc:seconds":
+			h := sample.Value.Float64Histogram()
+			s.GCPauseP99Ms = histogramQuantile(h, 0.99) * 1000
+			s.GCPauseMaxMs = histogramQuantile(h, 1) * 1000
+		}
+	}
+	return s
+}
+
+// histogramQuantile returns the upper bound of the bucket holding the q-th
+// quantile of a runtime histogram of seconds.
+func histogramQuantile(h *metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen >= rank && n > 0 {
+			upper := h.Buckets[i+1]
+			if math.IsInf(upper, 1) {
+				upper = h.Buckets[i]
+			}
+			return upper
+		}
+	}
+	return 0
+}
+
+func debugRuntimeFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, readRuntimeMetrics())
+}
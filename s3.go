@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gin-gonic/gin"
+)
+
+const s3ObjectKey = "sample.txt"
+
+var (
+	s3c      *s3.Client
+	s3Bucket = getEnv("S3_BUCKET", "sample-bucket")
+)
+
+// initS3 connects to the S3 compatible store (MinIO by default) and makes
+// sure the sample bucket exists.
+func initS3(ctx context.Context) error {
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(getEnv("AWS_REGION", "us-east-1")),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			getEnv("S3_ACCESS_KEY", "minioadmin"),
+			getEnv("S3_SECRET_KEY", "minioadmin"),
+			"",
+		)),
+	)
+	if err != nil {
+		return err
+	}
+	s3c = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(getEnv("S3_ENDPOINT", "http://minio:9000"))
+		o.UsePathStyle = true
+	})
+
+	_, err = s3c.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(s3Bucket)})
+	var owned *types.BucketAlreadyOwnedByYou
+	if errors.As(err, &owned) {
+		return nil
+	}
+	return err
+}
+
+// s3Store stores objects in an S3 bucket, uploading in parts so that
+// bodies of unknown length can be streamed.
+type s3Store struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+}
+
+func newS3Store(client *s3.Client, bucket string) s3Store {
+	return s3Store{client: client, uploader: manager.NewUploader(client), bucket: bucket}
+}
+
+func (s s3Store) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   cr,
+	})
+	return cr.n, err
+}
+
+func (s s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var noKey *types.NoSuchKey
+	if errors.As(err, &noKey) {
+		return nil, errObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func s3PutFunc(c *gin.Context) {
+	_, err := s3c.PutObject(c.Request.Context(), &s3.PutObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(s3ObjectKey),
+		Body:   strings.NewReader("hello from go gin"),
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "S3 put error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "S3 put: %s/%s", s3Bucket, s3ObjectKey)
+}
+
+func s3GetFunc(c *gin.Context) {
+	out, err := s3c.GetObject(c.Request.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(s3Bucket),
+		Key:    aws.String(s3ObjectKey),
+	})
+	var noKey *types.NoSuchKey
+	if errors.As(err, &noKey) {
+		c.String(http.StatusNotFound, "S3 object not found, call /s3/put first")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "S3 get error: %v", err)
+		return
+	}
+	defer out.Body.Close()
+	body, err := io.ReadAll(out.Body)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Read error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "S3 get: %s", body)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The checkout saga: stock is reserved in MySQL, a shipment is created in
+// Mongo and a checkout_completed event is published to Kafka. There is no
+// transaction spanning the three, so when a step fails the completed ones
+// are undone by their compensating actions, in reverse order.
+
+var (
+	errOutOfStock   = errors.New("out of stock")
+	errStepInjected = errors.New("failure injected")
+)
+
+// sagaOutcomes counts checkouts by outcome: completed, compensated or
+// compensation_failed.
+var sagaOutcomes = expvar.NewMap("saga")
+
+type checkoutRequest struct {
+	UserID   int64  `json:"user_id" binding:"required"`
+	SKU      string `json:"sku" binding:"required,max=64"`
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+}
+
+// sagaStep is one step of a saga. compensate, if set, undoes a completed
+// run.
+type sagaStep struct {
+	name       string
+	backend    string
+	run        func(ctx context.Context) error
+	compensate func(ctx context.Context) error
+}
+
+// sagaStepResult is the outcome of a step, reported in the response.
+type sagaStepResult struct {
+	Step       string  `json:"step"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// checkoutFunc runs the checkout saga. ?fail=reserve|shipment|publish makes
+// that step fail, to show the compensation of the steps before it.
+func checkoutFunc(c *gin.Context) {
+	var req checkoutRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	fail := c.Query("fail")
+	checkoutID := randomHex(8)
+	shipmentID := primitive.NewObjectID()
+	shipments := mdb.Database("sample_db").Collection("shipments")
+
+	steps := []sagaStep{
+		{
+			name:    "reserve",
+			backend: "mysql",
+			run: func(ctx context.Context) error {
+				res, err := mysqldb.ExecContext(ctx,
+					commented(ctx, "UPDATE stock SET quantity = quantity - ? WHERE sku = ? AND quantity >= ?"),
+					req.Quantity, req.SKU, req.Quantity)
+				if err != nil {
+					return err
+				}
+				if n, err := res.RowsAffected(); err != nil || n == 0 {
+					return errors.Join(errOutOfStock, err)
+				}
+				return nil
+			},
+			compensate: func(ctx context.Context) error {
+				_, err := mysqldb.ExecContext(ctx,
+					commented(ctx, "UPDATE stock SET quantity = quantity + ? WHERE sku = ?"),
+					req.Quantity, req.SKU)
+				return err
+			},
+		},
+		{
+			name:    "shipment",
+			backend: "mongo",
+			run: func(ctx context.Context) error {
+				_, err := shipments.InsertOne(ctx, bson.M{
+					"_id":         shipmentID,
+					"checkout_id": checkoutID,
+					"user_id":     req.UserID,
+					"sku":         req.SKU,
+					"quantity":    req.Quantity,
+					"status":      "pending",
+					"created_at":  clk.Now().UTC(),
+				})
+				return err
+			},
+			compensate: func(ctx context.Context) error {
+				_, err := shipments.DeleteOne(ctx, bson.M{"_id": shipmentID})
+				return err
+			},
+		},
+		{
+			name:    "publish",
+			backend: "kafka",
+			run: func(ctx context.Context) error {
+				value, err := json.Marshal(gin.H{
+					"type":        "checkout_completed",
+					"checkout_id": checkoutID,
+					"shipment_id": shipmentID.Hex(),
+					"user_id":     req.UserID,
+					"sku":         req.SKU,
+					"quantity":    req.Quantity,
+				})
+				if err != nil {
+					return err
+				}
+				// a retried checkout publishes under the same message ID
+				headers := newMessageHeaders(ctx)
+				headers[messageIDHeader] = "checkout-" + checkoutID
+				return bus.Produce(ctx, message{Key: []byte(checkoutID), Value: value, Headers: headers})
+			},
+		},
+	}
+
+	results, err := runSaga(c.Request.Context(), steps, fail)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errOutOfStock):
+			status = http.StatusConflict
+		case errors.Is(err, errStepInjected):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"error":       err.Error(),
+			"checkout_id": checkoutID,
+			"steps":       results,
+			"trace_id":    traceIDFromContext(c.Request.Context()),
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"checkout_id": checkoutID,
+		"shipment_id": shipmentID.Hex(),
+		"steps":       results,
+	})
+}
+
+// runSaga runs steps in order. If one fails, the completed steps are
+// compensated in reverse order, detached from ctx so that a request that
+// timed out still gets cleaned up. The step named fail fails without
+// running.
+func runSaga(ctx context.Context, steps []sagaStep, fail string) ([]sagaStepResult, error) {
+	var results []sagaStepResult
+	var err error
+	done := 0
+	for _, s := range steps {
+		var r sagaStepResult
+		r, err = runSagaStep(ctx, s.name, s.backend, func(ctx context.Context) error {
+			if s.name == fail {
+				return errStepInjected
+			}
+			return s.run(ctx)
+		})
+		results = append(results, r)
+		if err != nil {
+			break
+		}
+		done++
+	}
+	if err == nil {
+		sagaOutcomes.Add("completed", 1)
+		return results, nil
+	}
+	err = fmt.Errorf("%s: %w", steps[done].name, err)
+
+	outcome := "compensated"
+	cctx := context.WithoutCancel(ctx)
+	for i := done - 1; i >= 0; i-- {
+		s := steps[i]
+		if s.compensate == nil {
+			continue
+		}
+		r, cerr := runSagaStep(cctx, "compensate_"+s.name, s.backend, s.compensate)
+		results = append(results, r)
+		if cerr != nil {
+			outcome = "compensation_failed"
+			recordEvent(ctx, "saga", "compensating %s failed: %v", s.name, cerr)
+		}
+	}
+	sagaOutcomes.Add(outcome, 1)
+	return results, err
+}
+
+func runSagaStep(ctx context.Context, name, backend string, fn func(ctx context.Context) error) (sagaStepResult, error) {
+	ctx, cancel := backendContext(ctx, backend)
+	defer cancel()
+
+	start := clk.Now()
+	err := fn(ctx)
+	latency := clk.Since(start)
+	slog.Debug("saga step",
+		"trace_id", traceIDFromContext(ctx),
+		"step", name,
+		"duration", latency,
+		"error", err,
+	)
+	r := sagaStepResult{
+		Step:       name,
+		Status:     "ok",
+		DurationMs: float64(latency.Microseconds()) / 1000,
+	}
+	if err != nil {
+		r.Status, r.Error = "failed", err.Error()
+	}
+	return r, err
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scenarioStep is a change a scenario makes at At into its run. Disable
+// takes startup steps down as if their backends had failed, Enable brings
+// them back, and Latency sets the latency injected into backends, 0
+// removing it.
+type scenarioStep struct {
+	At      time.Duration
+	Note    string
+	Disable []string
+	Enable  []string
+	Latency map[string]time.Duration
+}
+
+// scenario is a scripted demo narrative: load on paths for duration, while
+// steps break and repair backends.
+type scenario struct {
+	description string
+	paths       []string
+	duration    time.Duration
+	steps       []scenarioStep
+}
+
+var scenarios = map[string]scenario{
+	"cache-outage": {
+		description: "Redis goes down and MySQL slows down under the load it takes over, then both recover",
+		paths:       []string{"/redis", "/mysql", "/"},
+		duration:    3 * time.Minute,
+		steps: []scenarioStep{
+			{
+				At:      30 * time.Second,
+				Note:    "Redis is down, MySQL is slowing down",
+				Disable: []string{"redis", "cache"},
+				Latency: map[string]time.Duration{"mysql": 300 * time.Millisecond},
+			},
+			{
+				At:      2*time.Minute + 30*time.Second,
+				Note:    "Redis is back, MySQL recovers",
+				Enable:  []string{"redis", "cache"},
+				Latency: map[string]time.Duration{"mysql": 0},
+			},
+		},
+	},
+	"slow-database": {
+		description: "MySQL slows down until its calls time out and its breaker opens, then recovers",
+		paths:       []string{"/mysql", "/"},
+		duration:    3 * time.Minute,
+		steps: []scenarioStep{
+			{
+				At:      30 * time.Second,
+				Note:    "MySQL is slowing down",
+				Latency: map[string]time.Duration{"mysql": 500 * time.Millisecond},
+			},
+			{
+				At:      time.Minute,
+				Note:    "MySQL calls are timing out",
+				Latency: map[string]time.Duration{"mysql": backendTimeouts["mysql"] + time.Second},
+			},
+			{
+				At:      2 * time.Minute,
+				Note:    "MySQL recovers",
+				Latency: map[string]time.Duration{"mysql": 0},
+			},
+		},
+	},
+	"mongo-outage": {
+		description: "Mongo goes down and its endpoints fail, then it comes back",
+		paths:       []string{"/mongo", "/"},
+		duration:    2 * time.Minute,
+		steps: []scenarioStep{
+			{At: 30 * time.Second, Note: "Mongo is down", Disable: []string{"mongo"}},
+			{At: 90 * time.Second, Note: "Mongo is back", Enable: []string{"mongo"}},
+		},
+	},
+}
+
+// scenarioRun is a run of a scenario. Its load's request IDs start with the
+// run's ID, so its traces and logs can be told apart from other traffic.
+type scenarioRun struct {
+	id     string
+	name   string
+	def    scenario
+	load   *soakRun
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	applied  int
+	disabled []string
+	slowed   map[string]bool
+}
+
+type scenarioReport struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Running      bool       `json:"running"`
+	StepsApplied int        `json:"steps_applied"`
+	Steps        int        `json:"steps"`
+	Load         soakReport `json:"load"`
+}
+
+// currentScenario is the running or last scenario run.
+var currentScenario atomic.Pointer[scenarioRun]
+
+func init() {
+	expvar.Publish("scenario", expvar.Func(func() any {
+		if r := currentScenario.Load(); r != nil {
+			return r.report()
+		}
+		return nil
+	}))
+}
+
+// run applies the scenario's steps in time while its load runs, and undoes
+// what they did at the end, or when the run is stopped. Trace logging is on
+// for the run.
+func (r *scenarioRun) run(ctx context.Context, baseURL string) {
+	defer close(r.done)
+	defer r.restore()
+	// log every request of the run, with its labeled request ID
+	if !traceLogEnabled.Swap(true) {
+		defer traceLogEnabled.Store(false)
+	}
+	recordEvent(ctx, "scenario", "scenario %s (%s) started: %s", r.name, r.id, r.def.description)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.load.run(ctx, baseURL)
+	}()
+	for _, step := range r.def.steps {
+		sleepCtx(ctx, step.At-clk.Since(r.load.started))
+		if ctx.Err() != nil {
+			break
+		}
+		r.apply(step)
+		recordEvent(ctx, "scenario", "scenario %s (%s): %s", r.name, r.id, step.Note)
+	}
+	wg.Wait()
+
+	rep := r.load.report()
+	slog.Info("scenario finished", "scenario", r.name, "id", r.id, "requests", rep.Requests, "errors", rep.Errors)
+	recordEvent(ctx, "scenario", "scenario %s (%s) finished: %d requests, %d errors",
+		r.name, r.id, rep.Requests, rep.Errors)
+}
+
+func (r *scenarioRun) apply(step scenarioStep) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.applied++
+	for _, name := range step.Disable {
+		if disableStep(name) {
+			r.disabled = append(r.disabled, name)
+		}
+	}
+	for _, name := range step.Enable {
+		// steps that were down before the run stay down
+		if i := slices.Index(r.disabled, name); i >= 0 {
+			enableStep(name)
+			r.disabled = slices.Delete(r.disabled, i, i+1)
+		}
+	}
+	for backend, d := range step.Latency {
+		setInjectedLatency(backend, d)
+		r.slowed[backend] = d > 0
+	}
+}
+
+// restore undoes the changes of the steps applied.
+func (r *scenarioRun) restore() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range r.disabled {
+		enableStep(name)
+	}
+	r.disabled = nil
+	for backend, slowed := range r.slowed {
+		if slowed {
+			setInjectedLatency(backend, 0)
+		}
+	}
+	clear(r.slowed)
+}
+
+func (r *scenarioRun) running() bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (r *scenarioRun) report() scenarioReport {
+	r.mu.Lock()
+	applied := r.applied
+	r.mu.Unlock()
+	return scenarioReport{
+		ID:           r.id,
+		Name:         r.name,
+		Description:  r.def.description,
+		Running:      r.running(),
+		StepsApplied: applied,
+		Steps:        len(r.def.steps),
+		Load:         r.load.report(),
+	}
+}
+
+// listScenariosFunc lists the scenarios and reports on the running or last
+// run.
+func listScenariosFunc(c *gin.Context) {
+	list := gin.H{}
+	for name, s := range scenarios {
+		list[name] = gin.H{"description": s.description, "duration": s.duration.String()}
+	}
+	resp := gin.H{"scenarios": list}
+	if r := currentScenario.Load(); r != nil {
+		resp["last_run"] = r.report()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// startScenarioFunc starts the named scenario, driving ?rps= requests a
+// second, SCENARIO_RPS by default, against the app at baseURL. Only one
+// scenario runs at a time.
+func startScenarioFunc(baseURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		def, ok := scenarios[name]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown scenario " + name})
+			return
+		}
+		rps, err := strconv.Atoi(c.DefaultQuery("rps", strconv.Itoa(getEnvInt("SCENARIO_RPS", 10))))
+		if err != nil || rps < 1 || rps > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rps must be between 1 and 1000"})
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &scenarioRun{
+			id:     name + "-" + randomHex(4),
+			name:   name,
+			def:    def,
+			load:   newSoakRun(def.paths, rps, def.duration, 10*time.Second),
+			cancel: cancel,
+			done:   make(chan struct{}),
+			slowed: map[string]bool{},
+		}
+		r.load.label = r.id
+		prev := currentScenario.Load()
+		if prev != nil && prev.running() {
+			cancel()
+			c.JSON(http.StatusConflict, gin.H{"error": "scenario " + prev.name + " is running"})
+			return
+		}
+		if !currentScenario.CompareAndSwap(prev, r) {
+			cancel()
+			c.JSON(http.StatusConflict, gin.H{"error": "another scenario was started meanwhile"})
+			return
+		}
+		go r.run(ctx, baseURL)
+		c.JSON(http.StatusAccepted, r.report())
+	}
+}
+
+// getScenarioFunc reports on the named scenario's running or last run.
+func getScenarioFunc(c *gin.Context) {
+	r := currentScenario.Load()
+	if r == nil || r.name != c.Param("name") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scenario " + c.Param("name") + " hasn't run"})
+		return
+	}
+	c.JSON(http.StatusOK, r.report())
+}
+
+// stopScenarioFunc stops the named scenario and undoes its changes.
+func stopScenarioFunc(c *gin.Context) {
+	r := currentScenario.Load()
+	if r == nil || r.name != c.Param("name") || !r.running() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scenario " + c.Param("name") + " isn't running"})
+		return
+	}
+	r.cancel()
+	<-r.done
+	c.JSON(http.StatusOK, r.report())
+}
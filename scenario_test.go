@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScenarioRunRestores(t *testing.T) {
+	// down before the run, so the run must leave it down
+	withoutSteps(t, "mongo")
+	t.Cleanup(func() {
+		enableStep("redis")
+		setInjectedLatency("mysql", 0)
+	})
+
+	r := &scenarioRun{slowed: map[string]bool{}}
+	r.apply(scenarioStep{
+		Disable: []string{"redis", "mongo"},
+		Latency: map[string]time.Duration{"mysql": 300 * time.Millisecond},
+	})
+	if stepAvailable("redis") || stepAvailable("mongo") {
+		t.Fatal("disabled steps are available")
+	}
+	if d := backendLatency("mysql"); d != 300*time.Millisecond {
+		t.Fatalf("got injected latency %s, want 300ms", d)
+	}
+
+	r.apply(scenarioStep{Enable: []string{"mongo"}})
+	if stepAvailable("mongo") {
+		t.Fatal("a step down before the run was enabled")
+	}
+
+	r.restore()
+	if !stepAvailable("redis") {
+		t.Fatal("redis wasn't enabled again")
+	}
+	if stepAvailable("mongo") {
+		t.Fatal("a step down before the run was enabled")
+	}
+	if d := backendLatency("mysql"); d != 0 {
+		t.Fatalf("got injected latency %s after restoring, want none", d)
+	}
+}
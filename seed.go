@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// seedEventKinds are the kinds of the seeded analytics events, most common
+// first.
+var seedEventKinds = []string{"page_view", "page_view", "page_view", "search", "add_to_cart", "checkout", "signup"}
+
+// initSeed fills the databases with demo data when SEED_DATA=true, so that
+// the demo endpoints return varied results from tables of realistic size.
+// It is safe to run on every start: users are keyed by email, and orders
+// and events are only seeded into empty tables.
+func initSeed(ctx context.Context) error {
+	if getEnv("SEED_DATA", "false") != "true" {
+		return nil
+	}
+	// a fixed seed, so that every instance seeds the same data
+	rnd := rand.New(rand.NewPCG(1, 2))
+	userIDs, err := seedUsers(ctx, getEnvInt("SEED_USERS", 200))
+	if err != nil {
+		return fmt.Errorf("seeding users: %w", err)
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+	orders := getEnvInt("SEED_ORDERS", 2000)
+	if err = seedMySQLOrders(ctx, rnd, userIDs, orders); err != nil {
+		return fmt.Errorf("seeding MySQL orders: %w", err)
+	}
+	if err = seedMongoOrders(ctx, rnd, userIDs, orders); err != nil {
+		return fmt.Errorf("seeding Mongo orders: %w", err)
+	}
+	if err = seedEvents(ctx, rnd, userIDs, getEnvInt("SEED_EVENTS", 20000)); err != nil {
+		return fmt.Errorf("seeding events: %w", err)
+	}
+	if err = appCache.Set(ctx, "key", "seeded value", 0); err != nil {
+		return fmt.Errorf("seeding cache: %w", err)
+	}
+	return nil
+}
+
+// seedUsers inserts n users unless they exist and returns the IDs of all
+// seeded users.
+func seedUsers(ctx context.Context, n int) ([]int64, error) {
+	const batch = 500
+	for from := 0; from < n; from += batch {
+		to := min(from+batch, n)
+		query := "INSERT IGNORE INTO users (name, email, created_at) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", to-from), ", ")
+		args := make([]any, 0, 3*(to-from))
+		for i := from; i < to; i++ {
+			args = append(args, fmt.Sprintf("Demo User %d", i+1), fmt.Sprintf("seed-%d@example.com", i+1),
+				clk.Now().UTC().Add(-time.Duration(n-i)*time.Hour).Truncate(time.Millisecond))
+		}
+		if _, err := mysqldb.ExecContext(ctx, query, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := mysqldb.QueryContext(ctx, "SELECT id FROM users WHERE email LIKE 'seed-%@example.com' ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	slog.Info("seeded users", "users", len(ids))
+	return ids, rows.Err()
+}
+
+// seedAmount returns an order amount: mostly small, occasionally large.
+func seedAmount(rnd *rand.Rand) float64 {
+	amount := 5 + rnd.ExpFloat64()*40
+	return float64(int(amount*100)) / 100
+}
+
+// seedTime returns a time within the last week.
+func seedTime(rnd *rand.Rand) time.Time {
+	return clk.Now().UTC().Add(-time.Duration(rnd.Int64N(int64(7 * 24 * time.Hour)))).Truncate(time.Millisecond)
+}
+
+func seedMySQLOrders(ctx context.Context, rnd *rand.Rand, userIDs []int64, n int) error {
+	var count int
+	if err := mysqldb.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders").Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	const batch = 500
+	for from := 0; from < n; from += batch {
+		to := min(from+batch, n)
+		query := "INSERT INTO orders (user_id, amount, created_at) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", to-from), ", ")
+		args := make([]any, 0, 3*(to-from))
+		for range to - from {
+			args = append(args, userIDs[rnd.IntN(len(userIDs))], seedAmount(rnd), seedTime(rnd))
+		}
+		if _, err := mysqldb.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	slog.Info("seeded MySQL orders", "orders", n)
+	return nil
+}
+
+func seedMongoOrders(ctx context.Context, rnd *rand.Rand, userIDs []int64, n int) error {
+	coll := mdb.Database("sample_db").Collection("orders")
+	count, err := coll.CountDocuments(ctx, bson.D{})
+	if err != nil || count > 0 || n == 0 {
+		return err
+	}
+	statuses := []string{"created", "paid", "paid", "shipped", "shipped", "delivered", "cancelled"}
+	docs := make([]any, n)
+	for i := range docs {
+		docs[i] = orderDocument{
+			UserID:    userIDs[rnd.IntN(len(userIDs))],
+			Amount:    seedAmount(rnd),
+			Status:    statuses[rnd.IntN(len(statuses))],
+			CreatedAt: seedTime(rnd),
+		}
+	}
+	if _, err = coll.InsertMany(ctx, docs); err != nil {
+		return err
+	}
+	slog.Info("seeded Mongo orders", "orders", n)
+	return nil
+}
+
+func seedEvents(ctx context.Context, rnd *rand.Rand, userIDs []int64, n int) error {
+	var count uint64
+	if err := ccn.QueryRow(ctx, "SELECT count() FROM events").Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	batch, err := ccn.PrepareBatch(ctx, "INSERT INTO events")
+	if err != nil {
+		return err
+	}
+	for range n {
+		kind := seedEventKinds[rnd.IntN(len(seedEventKinds))]
+		payload := fmt.Sprintf(`{"path":"/products/%d"}`, rnd.IntN(100))
+		if err = batch.Append(uuid.New(), kind, userIDs[rnd.IntN(len(userIDs))], payload, seedTime(rnd)); err != nil {
+			_ = batch.Abort()
+			return err
+		}
+	}
+	if err = batch.Send(); err != nil {
+		return err
+	}
+	slog.Info("seeded events", "events", n)
+	return nil
+}
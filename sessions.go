@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionCookie    = "session"
+	sessionKeyPrefix = "session:"
+)
+
+// sessionStats counts session store operations: loads (split into hits
+// and misses), saves and deletes.
+var sessionStats = expvar.NewMap("sessions")
+
+// sessionsMiddleware makes the session of the request available through
+// sessions.Default. Sessions live in Redis for SESSION_TTL, with only their
+// signed ID in the cookie; SESSION_SECRET signs the IDs. In local mode they
+// live in the cookie itself.
+func sessionsMiddleware() gin.HandlerFunc {
+	secret := []byte(getEnv("SESSION_SECRET", ""))
+	if len(secret) == 0 {
+		slog.Warn("SESSION_SECRET is not set, sessions won't survive restarts or be shared between instances")
+		secret = securecookie.GenerateRandomKey(32)
+	}
+	opts := sessions.Options{
+		Path:     "/",
+		MaxAge:   int(getEnvDuration("SESSION_TTL", 24*time.Hour).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	var store sessions.Store
+	if localMode() {
+		store = cookie.NewStore(secret)
+	} else {
+		store = &redisSessionStore{codecs: securecookie.CodecsFromPairs(secret)}
+	}
+	store.Options(opts)
+	return sessions.Sessions(sessionCookie, store)
+}
+
+// redisSessionStore is a sessions.Store keeping sessions in Redis through
+// the app's Redis client, so it works in every REDIS_MODE and its calls
+// carry the request's context.
+type redisSessionStore struct {
+	codecs  []securecookie.Codec
+	options *gsessions.Options
+}
+
+func (s *redisSessionStore) Options(opts sessions.Options) {
+	s.options = opts.ToGorillaOptions()
+}
+
+func (s *redisSessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns the session named by the request's cookie, or a new one if
+// there's no cookie or the session has expired.
+func (s *redisSessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.codecs...); err != nil {
+		// a tampered or stale cookie gets a new session
+		session.ID = ""
+		return session, nil
+	}
+
+	ctx, cancel := backendContext(r.Context(), "redis")
+	defer cancel()
+	sessionStats.Add("loads", 1)
+	b, err := rdb.Get(ctx, sessionKeyPrefix+session.ID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		sessionStats.Add("misses", 1)
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	sessionStats.Add("hits", 1)
+	if err = gob.NewDecoder(bytes.NewReader(b)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session for its MaxAge, renewing its expiry, or deletes
+// it if MaxAge is negative.
+func (s *redisSessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	ctx, cancel := backendContext(r.Context(), "redis")
+	defer cancel()
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			sessionStats.Add("deletes", 1)
+			if err := rdb.Del(ctx, sessionKeyPrefix+session.ID).Err(); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = randomHex(16)
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(session.Values); err != nil {
+		return err
+	}
+	sessionStats.Add("saves", 1)
+	ttl := time.Duration(session.Options.MaxAge) * time.Second
+	if err := rdb.Set(ctx, sessionKeyPrefix+session.ID, b.Bytes(), ttl).Err(); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// hasSessionCookie reports whether the request comes with a session
+// cookie, without loading the session.
+func hasSessionCookie(c *gin.Context) bool {
+	_, err := c.Cookie(sessionCookie)
+	return err == nil
+}
+
+// renewSessionID deletes the session stored under its current ID and has
+// the next save store it under a new one. Called on login, it keeps an ID
+// planted in the browser beforehand from being logged in too (session
+// fixation). Sessions kept in the cookie in local mode have no ID.
+func renewSessionID(c *gin.Context, session sessions.Session) error {
+	gs, ok := session.(interface{ Session() *gsessions.Session })
+	if !ok || gs.Session() == nil || gs.Session().ID == "" {
+		return nil
+	}
+	ctx, cancel := backendContext(c.Request.Context(), "redis")
+	defer cancel()
+	sessionStats.Add("deletes", 1)
+	if err := rdb.Del(ctx, sessionKeyPrefix+gs.Session().ID).Err(); err != nil {
+		return err
+	}
+	gs.Session().ID = ""
+	return nil
+}
+
+type loginRequest struct {
+	UserID int64 `json:"user_id" binding:"required,gt=0"`
+}
+
+// loginFunc starts a session for a user, e.g. {"user_id": 1}. It's a demo:
+// there are no passwords.
+func loginFunc(c *gin.Context) {
+	var req loginRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	u, err := userRepo.GetUser(c.Request.Context(), req.UserID)
+	if errors.Is(err, errNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unknown user"})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "User lookup error: %v", err)
+		return
+	}
+
+	session := sessions.Default(c)
+	if err = renewSessionID(c, session); err != nil {
+		respondError(c, http.StatusInternalServerError, "Session renew error: %v", err)
+		return
+	}
+	session.Clear()
+	session.Set("user_id", u.ID)
+	session.Set("name", u.Name)
+	session.Set("logged_in_at", clk.Now().UTC().Format(time.RFC3339))
+	if err = session.Save(); err != nil {
+		respondError(c, http.StatusInternalServerError, "Session save error: %v", err)
+		return
+	}
+	slog.Debug("session started",
+		"trace_id", traceIDFromContext(c.Request.Context()),
+		"user_id", u.ID,
+	)
+	c.JSON(http.StatusOK, gin.H{"user_id": u.ID, "name": u.Name})
+}
+
+// sessionFunc returns the session's user, renewing the session's expiry.
+// Users logged in through OIDC are identified by subject and email rather
+// than user ID.
+func sessionFunc(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := session.Get("user_id").(int64)
+	subject, _ := session.Get("oidc_subject").(string)
+	if !ok && subject == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not logged in"})
+		return
+	}
+	session.Set("last_seen_at", clk.Now().UTC().Format(time.RFC3339))
+	if err := session.Save(); err != nil {
+		respondError(c, http.StatusInternalServerError, "Session save error: %v", err)
+		return
+	}
+	if subject != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"subject":      subject,
+			"email":        session.Get("email"),
+			"name":         session.Get("name"),
+			"logged_in_at": session.Get("logged_in_at"),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":      userID,
+		"name":         session.Get("name"),
+		"logged_in_at": session.Get("logged_in_at"),
+	})
+}
+
+// logoutFunc ends the session.
+func logoutFunc(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
+	if err := session.Save(); err != nil {
+		respondError(c, http.StatusInternalServerError, "Session delete error: %v", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The /<backend>/slow endpoints run a query taking ?ms= milliseconds on the
+// server, for slow-query examples to tune alerts with. They bypass the
+// circuit breakers, which deliberate slowness shouldn't trip, and extend
+// the backend's timeout by the wanted duration; REQUEST_TIMEOUT or
+// ROUTE_TIMEOUTS still bound it. The MySQL and ClickHouse ones share their
+// backend's bulkhead with the other endpoints, so a burst of them shows
+// queueing there.
+
+const maxSlowQueryMs = 30_000
+
+// slowQuery parses ?ms= and returns a context for a query lasting that long,
+// or answers 400 and returns false.
+func slowQuery(c *gin.Context, backend string) (context.Context, context.CancelFunc, time.Duration, bool) {
+	ms, err := strconv.Atoi(c.DefaultQuery("ms", "2000"))
+	if err != nil || ms < 1 || ms > maxSlowQueryMs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ms must be between 1 and " + strconv.Itoa(maxSlowQueryMs)})
+		return nil, nil, 0, false
+	}
+	d := time.Duration(ms) * time.Millisecond
+	ctx, cancel := context.WithTimeout(c.Request.Context(), d+backendTimeouts[backend])
+	return ctx, cancel, d, true
+}
+
+// respondSlowQuery answers with how long the query took, or the error.
+func respondSlowQuery(c *gin.Context, backend string, d time.Duration, start time.Time, err error) {
+	elapsed := clk.Since(start)
+	slog.Debug("slow query",
+		"trace_id", traceIDFromContext(c.Request.Context()),
+		"backend", backend,
+		"requested", d,
+		"duration", elapsed,
+		"error", err,
+	)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Slow %s query error: %v", backend, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"backend":      backend,
+		"requested_ms": d.Milliseconds(),
+		"duration_ms":  elapsed.Milliseconds(),
+	})
+}
+
+// mysqlSlowFunc runs SELECT SLEEP(?).
+func mysqlSlowFunc(c *gin.Context) {
+	ctx, cancel, d, ok := slowQuery(c, "mysql")
+	if !ok {
+		return
+	}
+	defer cancel()
+	release, err := mysqlBulkhead.acquire(ctx)
+	if err != nil {
+		respondBulkheadError(c, err)
+		return
+	}
+	defer release()
+
+	start := clk.Now()
+	var slept int
+	err = mysqldb.QueryRowContext(ctx, commented(ctx, "SELECT SLEEP(?)"), d.Seconds()).Scan(&slept)
+	respondSlowQuery(c, "mysql", d, start, err)
+}
+
+// mongoSlowFunc finds a document with a $where clause sleeping on the
+// server. It upserts the document first, so there's one to match.
+func mongoSlowFunc(c *gin.Context) {
+	ctx, cancel, d, ok := slowQuery(c, "mongo")
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	start := clk.Now()
+	collection := mdb.Database("sample_db").Collection("sampleCollection")
+	filter := bson.D{{Key: "name", Value: "slow"}}
+	_, err := collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: filter}}, options.Update().SetUpsert(true))
+	if err == nil {
+		where := "sleep(" + strconv.FormatInt(d.Milliseconds(), 10) + ") || true"
+		filter = append(filter, bson.E{Key: "$where", Value: where})
+		err = collection.FindOne(ctx, filter).Err()
+	}
+	respondSlowQuery(c, "mongo", d, start, err)
+}
+
+// clickhouseSlowFunc aggregates over an endless numbers() table, stopped
+// after the wanted duration by max_execution_time with
+// timeout_overflow_mode=break, which returns the partial result.
+func clickhouseSlowFunc(c *gin.Context) {
+	ctx, cancel, d, ok := slowQuery(c, "clickhouse")
+	if !ok {
+		return
+	}
+	defer cancel()
+	release, err := clickhouseBulkhead.acquire(ctx)
+	if err != nil {
+		respondBulkheadError(c, err)
+		return
+	}
+	defer release()
+
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"max_execution_time":    d.Seconds(),
+		"timeout_overflow_mode": "break",
+	}))
+	start := clk.Now()
+	var count, sum uint64
+	err = ccn.QueryRow(ctx,
+		commented(ctx, "SELECT count(), sum(cityHash64(number)) FROM system.numbers"),
+	).Scan(&count, &sum)
+	respondSlowQuery(c, "clickhouse", d, start, err)
+}
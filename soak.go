@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// soakSegments is the number of segments the run's samples are split into
+// when looking for growth.
+const soakSegments = 4
+
+// soakMaxErrors bounds the distinct error messages kept for the report.
+const soakMaxErrors = 20
+
+type soakSample struct {
+	At         time.Time
+	HeapBytes  uint64
+	Goroutines int
+}
+
+// soakRun drives steady traffic against the app's own endpoints and samples
+// the heap and goroutine counts, to catch leaks that only show over time.
+// Scenarios use it to generate their load. With label set, the requests'
+// IDs are the label followed by a sequence number.
+type soakRun struct {
+	paths    []string
+	rps      int
+	duration time.Duration
+	interval time.Duration
+	label    string
+
+	requests  atomic.Int64
+	errors    atomic.Int64
+	bytesIn   atomic.Int64
+	latencies *latencyHistogram
+
+	mu            sync.Mutex
+	started       time.Time
+	lastRequest   time.Time
+	samples       []soakSample
+	statusCodes   map[int]int
+	errorMessages map[string]struct{}
+}
+
+type soakReport struct {
+	Started           time.Time `json:"started"`
+	Elapsed           string    `json:"elapsed"`
+	Requests          int64     `json:"requests"`
+	Errors            int64     `json:"errors"`
+	LatencyP50Ms      float64   `json:"latency_p50_ms"`
+	LatencyP99Ms      float64   `json:"latency_p99_ms"`
+	Samples           int       `json:"samples"`
+	HeapStartBytes    uint64    `json:"heap_start_bytes"`
+	HeapEndBytes      uint64    `json:"heap_end_bytes"`
+	GoroutinesStart   int       `json:"goroutines_start"`
+	GoroutinesEnd     int       `json:"goroutines_end"`
+	HeapGrowing       bool      `json:"heap_growing"`
+	GoroutinesGrowing bool      `json:"goroutines_growing"`
+}
+
+// soak is the current or last soak run, nil unless SOAK_DURATION is set.
+var soak atomic.Pointer[soakRun]
+
+func init() {
+	expvar.Publish("soak", expvar.Func(func() any {
+		if r := soak.Load(); r != nil {
+			return r.report()
+		}
+		return nil
+	}))
+}
+
+// runSoak runs a soak test against baseURL for SOAK_DURATION once the app
+// is ready, and logs its report at the end.
+func runSoak(ctx context.Context, baseURL string) {
+	duration := getEnvDuration("SOAK_DURATION", 0)
+	if duration <= 0 {
+		return
+	}
+	for !ready.Load() {
+		sleepCtx(ctx, 100*time.Millisecond)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	r := newSoakRun(strings.Split(getEnv("SOAK_PATHS", "/,/redis,/mysql,/mongo"), ","),
+		getEnvInt("SOAK_RPS", 20), duration, getEnvDuration("SOAK_SAMPLE_INTERVAL", 30*time.Second))
+	soak.Store(r)
+	slog.Info("soak test started", "duration", duration, "rps", r.rps, "paths", r.paths)
+	r.run(ctx, baseURL)
+
+	rep := r.report()
+	slog.Info("soak test finished",
+		"requests", rep.Requests,
+		"errors", rep.Errors,
+		"heap_start_bytes", rep.HeapStartBytes,
+		"heap_end_bytes", rep.HeapEndBytes,
+		"goroutines_start", rep.GoroutinesStart,
+		"goroutines_end", rep.GoroutinesEnd,
+		"heap_growing", rep.HeapGrowing,
+		"goroutines_growing", rep.GoroutinesGrowing,
+	)
+	if rep.HeapGrowing || rep.GoroutinesGrowing {
+		recordEvent(context.Background(), "soak", "possible leak: heap growing %t, goroutines growing %t",
+			rep.HeapGrowing, rep.GoroutinesGrowing)
+	}
+	if path := getEnv("SOAK_REPORT", ""); path != "" {
+		if err := r.writeVegetaReport(path); err != nil {
+			slog.Warn("writing soak report failed", "path", path, "error", err)
+		}
+	}
+}
+
+func newSoakRun(paths []string, rps int, duration, interval time.Duration) *soakRun {
+	return &soakRun{
+		paths:    paths,
+		rps:      max(rps, 1),
+		duration: duration,
+		interval: interval,
+		started:  clk.Now(),
+
+		latencies:     newLatencyHistogram(),
+		statusCodes:   map[int]int{},
+		errorMessages: map[string]struct{}{},
+	}
+}
+
+// run sends rps requests a second to the paths in turn for the run's
+// duration, or until ctx is done.
+func (r *soakRun) run(ctx context.Context, baseURL string) {
+	ctx, cancel := context.WithTimeout(ctx, r.duration)
+	defer cancel()
+	r.sample()
+	sampler := time.NewTicker(r.interval)
+	defer sampler.Stop()
+	requests := time.NewTicker(time.Second / time.Duration(r.rps))
+	defer requests.Stop()
+
+	var wg sync.WaitGroup
+	next := 0
+loop:
+	for {
+		select {
+		case <-requests.C:
+			path := r.paths[next%len(r.paths)]
+			next++
+			wg.Add(1)
+			go func(seq int) {
+				defer wg.Done()
+				r.hit(ctx, baseURL+path, seq)
+			}(next)
+		case <-sampler.C:
+			r.sample()
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	wg.Wait()
+	r.sample()
+}
+
+func (r *soakRun) hit(ctx context.Context, url string, seq int) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		r.failed(0, err)
+		return
+	}
+	if r.label != "" {
+		req.Header.Set(requestIDHeader, r.label+"-"+strconv.Itoa(seq))
+	}
+	start := clk.Now()
+	resp, err := hcl.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.failed(clk.Since(start), err)
+		}
+		return
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	r.done(clk.Since(start), resp.StatusCode, n)
+	if resp.StatusCode >= 500 {
+		r.errors.Add(1)
+	}
+}
+
+func (r *soakRun) done(latency time.Duration, status int, bytes int64) {
+	r.requests.Add(1)
+	r.bytesIn.Add(bytes)
+	r.latencies.record(latency)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statusCodes[status]++
+	r.lastRequest = clk.Now()
+}
+
+func (r *soakRun) failed(latency time.Duration, err error) {
+	r.errors.Add(1)
+	r.done(latency, 0, 0)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.errorMessages) < soakMaxErrors {
+		r.errorMessages[err.Error()] = struct{}{}
+	}
+}
+
+func (r *soakRun) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, soakSample{
+		At:         clk.Now(),
+		HeapBytes:  m.HeapAlloc,
+		Goroutines: runtime.NumGoroutine(),
+	})
+}
+
+func (r *soakRun) report() soakReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep := soakReport{
+		Started:  r.started,
+		Elapsed:  clk.Since(r.started).Round(time.Second).String(),
+		Requests: r.requests.Load(),
+		Errors:   r.errors.Load(),
+		Samples:  len(r.samples),
+
+		LatencyP50Ms: float64(r.latencies.quantile(0.5)) / float64(time.Millisecond),
+		LatencyP99Ms: float64(r.latencies.quantile(0.99)) / float64(time.Millisecond),
+	}
+	if len(r.samples) == 0 {
+		return rep
+	}
+	first, last := r.samples[0], r.samples[len(r.samples)-1]
+	rep.HeapStartBytes, rep.HeapEndBytes = first.HeapBytes, last.HeapBytes
+	rep.GoroutinesStart, rep.GoroutinesEnd = first.Goroutines, last.Goroutines
+
+	heap := make([]float64, len(r.samples))
+	goroutines := make([]float64, len(r.samples))
+	for i, s := range r.samples {
+		heap[i], goroutines[i] = float64(s.HeapBytes), float64(s.Goroutines)
+	}
+	rep.HeapGrowing = growing(heap)
+	rep.GoroutinesGrowing = growing(goroutines)
+	return rep
+}
+
+// growing reports whether values grow steadily: the minimum of each of
+// soakSegments consecutive segments is above the one before, and the last
+// is at least 10% above the first. Minima rather than means are compared
+// so that garbage awaiting collection doesn't count as growth.
+func growing(values []float64) bool {
+	if len(values) < 2*soakSegments {
+		return false
+	}
+	size := len(values) / soakSegments
+	var prev, first float64
+	for i := range soakSegments {
+		lowest := values[i*size]
+		for _, v := range values[i*size : (i+1)*size] {
+			lowest = min(lowest, v)
+		}
+		if i == 0 {
+			first = lowest
+		} else if lowest <= prev {
+			return false
+		}
+		prev = lowest
+	}
+	return prev >= first*1.1
+}
+
+func debugSoakFunc(c *gin.Context) {
+	r := soak.Load()
+	if r == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no soak test has run, set SOAK_DURATION"})
+		return
+	}
+	if c.Query("format") == "vegeta" {
+		c.JSON(http.StatusOK, r.vegetaReport())
+		return
+	}
+	c.JSON(http.StatusOK, r.report())
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// appFS holds the frontend served at /app: a page calling the API with
+// traceparent headers generated in the browser.
+//
+//go:embed web/app
+var appFS embed.FS
+
+// appFunc serves the embedded frontend.
+func appFunc() gin.HandlerFunc {
+	sub, err := fs.Sub(appFS, "web/app")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix("/app", http.FileServerFS(sub))
+	return func(c *gin.Context) {
+		if c.Param("filepath") == "" {
+			c.Redirect(http.StatusMovedPermanently, "/app/")
+			return
+		}
+		files.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "context"
+
+// sqlCommentsEnabled turns on sqlcommenter style comments carrying the
+// traceparent of the request, so that a query in the database's slow log or
+// process list can be tied back to its trace.
+var sqlCommentsEnabled = getEnv("SQL_COMMENTS", "false") == "true"
+
+// commented prepends a /*traceparent='...'*/ comment to query when SQL
+// comments are enabled and ctx belongs to a request. ClickHouse batch
+// inserts can't carry it, as the driver rebuilds their INSERT statement.
+func commented(ctx context.Context, query string) string {
+	if !sqlCommentsEnabled {
+		return query
+	}
+	tp := traceparentFromContext(ctx)
+	if tp == "" {
+		return query
+	}
+	return "/*traceparent='" + tp + "'*/ " + query
+}
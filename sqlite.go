@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// sqlitedb is an in-process database, available even when none of the
+// backend containers are running.
+var sqlitedb *sql.DB
+
+func initSQLite(ctx context.Context) error {
+	db, err := sql.Open("sqlite", getEnv("SQLITE_DSN", ":memory:"))
+	if err != nil {
+		return err
+	}
+	// every connection to :memory: opens a new, empty database
+	db.SetMaxOpenConns(1)
+	sqlitedb = db
+	_, err = sqlitedb.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS visits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL,
+		visited_at TEXT NOT NULL
+	)`)
+	return err
+}
+
+func sqliteFunc(c *gin.Context) {
+	ctx := c.Request.Context()
+	_, err := sqlitedb.ExecContext(ctx, "INSERT INTO visits (path, visited_at) VALUES (?, ?)", c.Request.URL.Path, clk.Now().UTC())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "SQLite insert error: %v", err)
+		return
+	}
+	var visits int
+	if err = sqlitedb.QueryRowContext(ctx, "SELECT COUNT(*) FROM visits").Scan(&visits); err != nil {
+		respondError(c, http.StatusInternalServerError, "SQLite error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "SQLite called: %d visits", visits)
+}
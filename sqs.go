@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gin-gonic/gin"
+)
+
+const sqsQueueName = "sample_queue"
+
+var (
+	sqsc        *sqs.Client
+	sqsQueueURL string
+)
+
+// loadAWSConfig returns the AWS config used for the services emulated by
+// LocalStack, whose endpoint is set with AWS_ENDPOINT.
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(getEnv("AWS_REGION", "us-east-1")),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			getEnv("AWS_ACCESS_KEY_ID", "test"),
+			getEnv("AWS_SECRET_ACCESS_KEY", "test"),
+			"",
+		)),
+	)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.BaseEndpoint = aws.String(getEnv("AWS_ENDPOINT", "http://localstack:4566"))
+	return cfg, nil
+}
+
+func initSQS(ctx context.Context) error {
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return err
+	}
+	sqsc = sqs.NewFromConfig(cfg)
+
+	// CreateQueue is idempotent for identical attributes
+	out, err := sqsc.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String(sqsQueueName)})
+	if err != nil {
+		return err
+	}
+	sqsQueueURL = aws.ToString(out.QueueUrl)
+	return nil
+}
+
+func sqsSendFunc(c *gin.Context) {
+	out, err := sqsc.SendMessage(c.Request.Context(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String(sqsQueueURL),
+		MessageBody: aws.String("hello from go gin"),
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "SQS send error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "SQS sent: %s", aws.ToString(out.MessageId))
+}
+
+func sqsReceiveFunc(c *gin.Context) {
+	out, err := sqsc.ReceiveMessage(c.Request.Context(), &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(sqsQueueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     1,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "SQS receive error: %v", err)
+		return
+	}
+	for _, msg := range out.Messages {
+		_, err = sqsc.DeleteMessage(c.Request.Context(), &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(sqsQueueURL),
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "SQS delete error: %v", err)
+			return
+		}
+	}
+	c.String(http.StatusOK, "SQS received: %d messages", len(out.Messages))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+)
+
+// initStep is a unit of startup work. A step runs as soon as every step
+// named in deps has completed, so independent steps run in parallel. Each
+// step is bounded by timeout, or INIT_TIMEOUT when unset. A step with skip
+// set doesn't run, and neither do the steps depending on it; the routes
+// needing them answer 503 instead. The same goes for an optional step that
+// fails, whose error is logged rather than failing startup.
+type initStep struct {
+	name     string
+	deps     []string
+	timeout  time.Duration
+	skip     bool
+	optional bool
+	run      func(ctx context.Context) error
+}
+
+// unavailableSteps holds the names of the steps that didn't run or failed.
+var unavailableSteps sync.Map
+
+// stepAvailable reports whether the named step completed, or will once
+// startup is done.
+func stepAvailable(name string) bool {
+	_, ok := unavailableSteps.Load(name)
+	return !ok
+}
+
+// requireSteps answers 503 to requests to a route needing a step that
+// didn't run or failed.
+func requireSteps(names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range names {
+			if !stepAvailable(name) {
+				respondError(c, http.StatusServiceUnavailable, "%s is unavailable", name)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// runSteps runs steps in dependency order and returns the first error
+// encountered, cancelling the steps still in flight.
+func runSteps(ctx context.Context, steps []initStep) error {
+	if err := checkSteps(steps); err != nil {
+		return err
+	}
+
+	defTimeout := getEnvDuration("INIT_TIMEOUT", 10*time.Second)
+	done := make(map[string]chan struct{}, len(steps))
+	for _, s := range steps {
+		done[s.name] = make(chan struct{})
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, s := range steps {
+		g.Go(func() error {
+			for _, dep := range s.deps {
+				select {
+				case <-done[dep]:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if s.skip || !depsAvailable(s.deps) {
+				unavailableSteps.Store(s.name, true)
+				slog.Info("skipped", "step", s.name)
+				close(done[s.name])
+				return nil
+			}
+
+			timeout := s.timeout
+			if timeout == 0 {
+				timeout = defTimeout
+			}
+			stepCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := clk.Now()
+			if err := s.run(stepCtx); err != nil {
+				if !s.optional {
+					return fmt.Errorf("%s: %w", s.name, err)
+				}
+				unavailableSteps.Store(s.name, true)
+				slog.Warn("optional step failed", "step", s.name, "error", err)
+				close(done[s.name])
+				return nil
+			}
+			slog.Info("initialized", "step", s.name, "duration", clk.Since(start))
+			close(done[s.name])
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+func depsAvailable(deps []string) bool {
+	for _, dep := range deps {
+		if !stepAvailable(dep) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSteps rejects unknown dependencies and dependency cycles, either of
+// which would otherwise block runSteps forever.
+func checkSteps(steps []initStep) error {
+	deps := make(map[string][]string, len(steps))
+	for _, s := range steps {
+		deps[s.name] = s.deps
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("startup dependency cycle at %q", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("startup step %q depends on unknown step %q", name, dep)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, s := range steps {
+		if err := visit(s.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckSteps(t *testing.T) {
+	step := func(name string, deps ...string) initStep {
+		return initStep{name: name, deps: deps}
+	}
+	tests := []struct {
+		name    string
+		steps   []initStep
+		wantErr string
+	}{
+		{name: "no steps"},
+		{name: "independent", steps: []initStep{step("a"), step("b")}},
+		{name: "chain", steps: []initStep{step("c", "b"), step("b", "a"), step("a")}},
+		{name: "diamond", steps: []initStep{step("a"), step("b", "a"), step("c", "a"), step("d", "b", "c")}},
+		{name: "unknown dependency", steps: []initStep{step("a", "missing")}, wantErr: `depends on unknown step "missing"`},
+		{name: "self cycle", steps: []initStep{step("a", "a")}, wantErr: "cycle"},
+		{name: "cycle", steps: []initStep{step("a", "c"), step("b", "a"), step("c", "b")}, wantErr: "cycle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSteps(tt.steps)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunSteps(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		ran []string
+	)
+	run := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, name)
+			return err
+		}
+	}
+	errDown := errors.New("down")
+	err := runSteps(context.Background(), []initStep{
+		{name: "test-db", run: run("test-db", nil)},
+		{name: "test-schema", deps: []string{"test-db"}, run: run("test-schema", nil)},
+		{name: "test-skipped", skip: true, run: run("test-skipped", nil)},
+		{name: "test-needs-skipped", deps: []string{"test-skipped"}, run: run("test-needs-skipped", nil)},
+		{name: "test-optional", optional: true, run: run("test-optional", errDown)},
+		{name: "test-needs-optional", deps: []string{"test-optional"}, run: run("test-needs-optional", nil)},
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if i, j := slices.Index(ran, "test-db"), slices.Index(ran, "test-schema"); i < 0 || j < i {
+		t.Errorf("ran %v, want test-db before test-schema", ran)
+	}
+	for _, name := range []string{"test-skipped", "test-needs-skipped", "test-needs-optional"} {
+		if slices.Contains(ran, name) {
+			t.Errorf("%s ran", name)
+		}
+	}
+	for name, want := range map[string]bool{
+		"test-schema":         true,
+		"test-skipped":        false,
+		"test-needs-skipped":  false,
+		"test-optional":       false,
+		"test-needs-optional": false,
+	} {
+		if got := stepAvailable(name); got != want {
+			t.Errorf("stepAvailable(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	err = runSteps(context.Background(), []initStep{
+		{name: "test-required", run: run("test-required", errDown)},
+	})
+	if !errors.Is(err, errDown) {
+		t.Errorf("failing required step: got error %v, want %v", err, errDown)
+	}
+}
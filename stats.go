@@ -0,0 +1,103 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// statsWindow is how long completed request samples are kept.
+	statsWindow = 5 * time.Minute
+	// statsMaxSamples bounds memory use under heavy load.
+	statsMaxSamples = 100000
+)
+
+type requestSample struct {
+	at      time.Time
+	route   string
+	tenant  string
+	status  int
+	latency time.Duration
+}
+
+// requestStats keeps samples of recently completed requests, from which
+// throughput and latency percentiles are computed.
+type requestStats struct {
+	inFlight atomic.Int64
+
+	mu      sync.Mutex
+	samples []requestSample // ordered by completion time
+}
+
+var reqStats = &requestStats{}
+
+// statsMiddleware records every request into reqStats.
+func statsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqStats.inFlight.Add(1)
+		start := clk.Now()
+		c.Next()
+		reqStats.inFlight.Add(-1)
+		if c.GetBool(untracedKey) {
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		reqStats.add(requestSample{
+			at:      clk.Now(),
+			route:   c.Request.Method + " " + route,
+			tenant:  tenantFromContext(c.Request.Context()),
+			status:  c.Writer.Status(),
+			latency: clk.Since(start),
+		})
+	}
+}
+
+func (s *requestStats) add(sample requestSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, sample)
+	s.pruneLocked(sample.at)
+}
+
+func (s *requestStats) pruneLocked(now time.Time) {
+	i, _ := slices.BinarySearchFunc(s.samples, now.Add(-statsWindow), func(rs requestSample, t time.Time) int {
+		return rs.at.Compare(t)
+	})
+	i = max(i, len(s.samples)-statsMaxSamples)
+	if i > 0 {
+		s.samples = slices.Delete(s.samples, 0, i)
+	}
+}
+
+// since returns a copy of the samples completed within d of now.
+func (s *requestStats) since(d time.Duration) []requestSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := clk.Now().Add(-d)
+	i, _ := slices.BinarySearchFunc(s.samples, cutoff, func(rs requestSample, t time.Time) int {
+		return rs.at.Compare(t)
+	})
+	return slices.Clone(s.samples[i:])
+}
+
+// percentile returns the p-th percentile (0-100) of the samples' latencies.
+func percentile(samples []requestSample, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	latencies := make([]time.Duration, len(samples))
+	for i, rs := range samples {
+		latencies[i] = rs.latency
+	}
+	slices.Sort(latencies)
+	idx := int(float64(len(latencies)-1) * p / 100)
+	return latencies[idx]
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	streamName  = "sample_stream"
+	streamGroup = "sample_group"
+
+	// streamMaxDeliveries is how often an entry is attempted before it is
+	// given up on.
+	streamMaxDeliveries = 5
+)
+
+var (
+	streamLag       = expvar.NewInt("stream_lag")
+	streamPending   = expvar.NewInt("stream_pending")
+	streamProcessed = expvar.NewInt("stream_processed")
+)
+
+// streamsAddFunc appends an entry to the stream. With ?fail=true, processing
+// the entry fails on its first attempts so that it gets retried.
+func streamsAddFunc(c *gin.Context) {
+	id, err := rdb.XAdd(c.Request.Context(), &redis.XAddArgs{
+		Stream: streamName,
+		Values: map[string]any{
+			"body":        c.DefaultQuery("message", "hello"),
+			"fail":        c.DefaultQuery("fail", "false"),
+			"traceparent": traceparentFromContext(c.Request.Context()),
+		},
+	}).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Redis XADD error: %v", err)
+		return
+	}
+	c.String(http.StatusOK, "Redis stream entry added: %s", id)
+}
+
+// runStreamWorker consumes the stream as a member of streamGroup until ctx
+// is done, retrying entries that stayed pending for STREAM_RETRY_IDLE.
+func runStreamWorker(ctx context.Context) {
+	if !stepAvailable("redis") {
+		return
+	}
+	consumer, _ := os.Hostname()
+	retryIdle := getEnvDuration("STREAM_RETRY_IDLE", 5*time.Second)
+
+	for ctx.Err() == nil {
+		err := rdb.XGroupCreateMkStream(ctx, streamName, streamGroup, "0").Err()
+		if err == nil || strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			break
+		}
+		slog.Warn("streams: creating consumer group failed", "error", err)
+		sleepCtx(ctx, 5*time.Second)
+	}
+
+	for ctx.Err() == nil {
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    streamGroup,
+			Consumer: consumer,
+			Streams:  []string{streamName, ">"},
+			Count:    10,
+			Block:    2 * time.Second,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if ctx.Err() == nil {
+				slog.Warn("streams: XREADGROUP failed", "error", err)
+				sleepCtx(ctx, time.Second)
+			}
+			continue
+		}
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				handleStreamEntry(ctx, msg, 1)
+			}
+		}
+		retryPendingEntries(ctx, consumer, retryIdle)
+		updateStreamGauges(ctx)
+	}
+}
+
+// handleStreamEntry acknowledges the entry once it has been processed.
+// Entries that fail stay pending until retryPendingEntries picks them up.
+func handleStreamEntry(ctx context.Context, msg redis.XMessage, attempt int64) {
+	if msg.Values["fail"] == "true" && attempt < 3 {
+		slog.Warn("streams: processing failed", "id", msg.ID, "attempt", attempt)
+		return
+	}
+	slog.Info("streams: entry processed",
+		"id", msg.ID,
+		"attempt", attempt,
+		"trace_id", randomHex(16),
+		"link_trace_id", parseTraceparent(fmt.Sprint(msg.Values["traceparent"])),
+	)
+	streamProcessed.Add(1)
+	if err := rdb.XAck(ctx, streamName, streamGroup, msg.ID).Err(); err != nil {
+		slog.Warn("streams: XACK failed", "id", msg.ID, "error", err)
+	}
+}
+
+// retryPendingEntries claims entries that have been pending for at least
+// idle and processes them again, giving up on those delivered too often.
+func retryPendingEntries(ctx context.Context, consumer string, idle time.Duration) {
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: streamName,
+		Group:  streamGroup,
+		Idle:   idle,
+		Start:  "-",
+		End:    "+",
+		Count:  10,
+	}).Result()
+	if err != nil {
+		slog.Warn("streams: XPENDING failed", "error", err)
+		return
+	}
+	for _, p := range pending {
+		if p.RetryCount >= streamMaxDeliveries {
+			_ = rdb.XAck(ctx, streamName, streamGroup, p.ID).Err()
+			recordEvent(ctx, "dead_letter", "stream entry %s dropped after %d deliveries", p.ID, p.RetryCount)
+			continue
+		}
+		msgs, err := rdb.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   streamName,
+			Group:    streamGroup,
+			Consumer: consumer,
+			MinIdle:  idle,
+			Messages: []string{p.ID},
+		}).Result()
+		if err != nil {
+			slog.Warn("streams: XCLAIM failed", "id", p.ID, "error", err)
+			continue
+		}
+		for _, msg := range msgs {
+			handleStreamEntry(ctx, msg, p.RetryCount+1)
+		}
+	}
+}
+
+func updateStreamGauges(ctx context.Context) {
+	groups, err := rdb.XInfoGroups(ctx, streamName).Result()
+	if err != nil {
+		return
+	}
+	for _, g := range groups {
+		if g.Name == streamGroup {
+			streamLag.Set(g.Lag)
+			streamPending.Set(g.Pending)
+		}
+	}
+}
+
+// sleepCtx sleeps for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-clk.After(d):
+	case <-ctx.Done():
+	}
+}
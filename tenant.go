@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tenantHeader = "X-Tenant-ID"
+
+	// tenantBaggageKey is the W3C baggage member carrying the tenant to
+	// downstream services.
+	tenantBaggageKey = "tenant.id"
+)
+
+// tenants are the known tenants. Requests for others are rejected, which
+// keeps the tenant a low-cardinality label in logs and metrics.
+var tenants = getEnvList("TENANTS", "acme,globex,initech")
+
+// tenantRequests counts requests per tenant, and those for unknown tenants.
+var tenantRequests = expvar.NewMap("tenants")
+
+type tenantKey struct{}
+
+// tenantMiddleware takes the request's tenant from the X-Tenant-ID header,
+// or from the tenant.id member of a baggage header set by an upstream
+// service, and stores it in the request context, from which it's added to
+// logs and metrics and propagated as baggage on downstream calls. Requests
+// naming an unknown tenant are rejected; requests naming none are served
+// without one.
+func tenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.GetHeader(tenantHeader)
+		if tenant == "" {
+			tenant = tenantFromBaggage(c.GetHeader("baggage"))
+		}
+		if tenant == "" {
+			c.Next()
+			return
+		}
+		if !slices.Contains(tenants, tenant) {
+			tenantRequests.Add("unknown", 1)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown tenant", "tenants": tenants})
+			return
+		}
+		tenantRequests.Add(tenant, 1)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), tenantKey{}, tenant))
+		c.Next()
+	}
+}
+
+// tenantFromContext returns the tenant of the request ctx belongs to, if
+// any.
+func tenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// baggageFromContext returns a W3C baggage header value carrying the tenant
+// of the request ctx belongs to, or "" if it has none.
+func baggageFromContext(ctx context.Context) string {
+	tenant := tenantFromContext(ctx)
+	if tenant == "" {
+		return ""
+	}
+	return tenantBaggageKey + "=" + tenant
+}
+
+// tenantFromBaggage returns the tenant.id member of a baggage header value
+// of the form key=value;properties,key=value.
+func tenantFromBaggage(h string) string {
+	for _, member := range strings.Split(h, ",") {
+		kv, _, _ := strings.Cut(member, ";")
+		k, v, ok := strings.Cut(kv, "=")
+		if ok && strings.TrimSpace(k) == tenantBaggageKey {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tlsClientCerts counts requests by whether they came with a client
+// certificate.
+var tlsClientCerts = expvar.NewMap("tls_client_certs")
+
+// tlsClientAuthModes maps TLS_CLIENT_AUTH values to how client certificates
+// are asked for and checked.
+var tlsClientAuthModes = map[string]tls.ClientAuthType{
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// serverTLSConfig returns the TLS configuration of the HTTP server, or nil
+// if TLS_CERT_FILE and TLS_KEY_FILE aren't set and the server speaks plain
+// HTTP. With TLS_CLIENT_CA_FILE, clients authenticate with certificates
+// signed by that CA (mTLS); TLS_CLIENT_AUTH relaxes how strictly.
+func serverTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := getEnv("TLS_CERT_FILE", ""), getEnv("TLS_KEY_FILE", "")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if caFile := getEnv("TLS_CLIENT_CA_FILE", ""); caFile != "" {
+		config.ClientCAs = x509.NewCertPool()
+		if err = appendCertFile(config.ClientCAs, caFile); err != nil {
+			return nil, err
+		}
+		mode := getEnv("TLS_CLIENT_AUTH", "require_and_verify")
+		auth, ok := tlsClientAuthModes[mode]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS_CLIENT_AUTH %q", mode)
+		}
+		config.ClientAuth = auth
+	}
+	return config, nil
+}
+
+// clientTLSConfig returns the TLS configuration of the app's HTTP client
+// for calling itself and its peers when they serve TLS: trusting
+// TLS_CA_FILE besides the system roots, and presenting the certificate in
+// TLS_CLIENT_CERT_FILE and TLS_CLIENT_KEY_FILE to servers asking for one.
+func clientTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := getEnv("TLS_CA_FILE", ""); caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if err = appendCertFile(pool, caFile); err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	certFile, keyFile := getEnv("TLS_CLIENT_CERT_FILE", ""), getEnv("TLS_CLIENT_KEY_FILE", "")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// appendCertFile adds the PEM certificates in file to pool.
+func appendCertFile(pool *x509.CertPool, file string) error {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates in %s", file)
+	}
+	return nil
+}
+
+type clientCertKey struct{}
+
+// clientCertMiddleware stores the subject of the client certificate of
+// requests over mTLS in the request context, for logs, and returns it in
+// the X-Client-Cert-Subject response header.
+func clientCertMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil {
+			c.Next()
+			return
+		}
+		if len(c.Request.TLS.PeerCertificates) == 0 {
+			tlsClientCerts.Add("absent", 1)
+			c.Next()
+			return
+		}
+		subject := c.Request.TLS.PeerCertificates[0].Subject.String()
+		if len(c.Request.TLS.VerifiedChains) > 0 {
+			tlsClientCerts.Add("verified", 1)
+		} else {
+			tlsClientCerts.Add("unverified", 1)
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), clientCertKey{}, subject))
+		c.Header("X-Client-Cert-Subject", subject)
+		c.Next()
+	}
+}
+
+// clientCertFromContext returns the client certificate subject of the
+// request ctx belongs to, if it came over mTLS.
+func clientCertFromContext(ctx context.Context) string {
+	subject, _ := ctx.Value(clientCertKey{}).(string)
+	return subject
+}
+
+// selfURL is the base URL of the app's own HTTP server, for warm-up and
+// soak requests.
+func selfURL(tlsConfig *tls.Config) string {
+	if tlsConfig != nil {
+		return "https://localhost:8000"
+	}
+	return "http://localhost:8000"
+}
+
+// newHTTPClient returns the app's HTTP client, set up for TLS peers.
+func newHTTPClient() (http.Client, error) {
+	config, err := clientTLSConfig()
+	if err != nil {
+		return http.Client{}, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type routeSummary struct {
+	Route  string  `json:"route"`
+	Count  int     `json:"count"`
+	Errors int     `json:"errors"`
+	P95Ms  float64 `json:"p95_ms"`
+	MaxMs  float64 `json:"max_ms"`
+
+	samples    []requestSample
+	maxLatency time.Duration
+}
+
+// summarizeRoutes aggregates samples per route.
+func summarizeRoutes(samples []requestSample) []*routeSummary {
+	byRoute := map[string]*routeSummary{}
+	for _, rs := range samples {
+		sum, ok := byRoute[rs.route]
+		if !ok {
+			sum = &routeSummary{Route: rs.route}
+			byRoute[rs.route] = sum
+		}
+		sum.Count++
+		if rs.status >= http.StatusInternalServerError {
+			sum.Errors++
+		}
+		sum.maxLatency = max(sum.maxLatency, rs.latency)
+		sum.samples = append(sum.samples, rs)
+	}
+
+	out := make([]*routeSummary, 0, len(byRoute))
+	for _, sum := range byRoute {
+		sum.P95Ms = float64(percentile(sum.samples, 95).Microseconds()) / 1000
+		sum.MaxMs = float64(sum.maxLatency.Microseconds()) / 1000
+		out = append(out, sum)
+	}
+	return out
+}
+
+// debugTopFunc reports the slowest routes by p95 latency and the routes
+// with the most server errors over the last five minutes, for all requests
+// or those of ?tenant=.
+func debugTopFunc(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "5"))
+	if err != nil || n < 1 {
+		c.String(http.StatusBadRequest, "n must be a positive integer")
+		return
+	}
+	samples := reqStats.since(statsWindow)
+	if tenant := c.Query("tenant"); tenant != "" {
+		samples = slices.DeleteFunc(samples, func(rs requestSample) bool {
+			return rs.tenant != tenant
+		})
+	}
+	routes := summarizeRoutes(samples)
+
+	slowest := slices.Clone(routes)
+	slices.SortFunc(slowest, func(a, b *routeSummary) int {
+		return cmp.Compare(b.P95Ms, a.P95Ms)
+	})
+
+	var errorLeaders []*routeSummary
+	for _, r := range routes {
+		if r.Errors > 0 {
+			errorLeaders = append(errorLeaders, r)
+		}
+	}
+	slices.SortFunc(errorLeaders, func(a, b *routeSummary) int {
+		return cmp.Compare(b.Errors, a.Errors)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"window":  statsWindow.String(),
+		"slowest": slowest[:min(n, len(slowest))],
+		"errors":  errorLeaders[:min(n, len(errorLeaders))],
+	})
+}
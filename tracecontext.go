@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type traceIDKey struct{}
+
+// traceContextMiddleware continues the trace of an incoming W3C traceparent
+// header, or starts a new one, and stores the trace ID in the request
+// context so that log lines and events can be tied back to it. The trace ID
+// is returned in X-Trace-Id and traceparent response headers so that API
+// clients can look the trace up.
+func traceContextMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		traceID := parseTraceparent(c.GetHeader("traceparent"))
+		if traceID == "" {
+			traceID = randomHex(16)
+		}
+		ctx := context.WithValue(c.Request.Context(), traceIDKey{}, traceID)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Header("X-Trace-Id", traceID)
+		c.Header("traceparent", traceparentFromContext(ctx))
+		c.Next()
+	}
+}
+
+// parseTraceparent returns the trace ID of a traceparent header of the form
+// version-traceid-parentid-flags, or "" if it's malformed.
+func parseTraceparent(h string) string {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	for _, r := range parts[1] {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return ""
+		}
+	}
+	return parts[1]
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceIDFromContext returns the trace ID of the request ctx belongs to, if
+// any.
+func traceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// traceparentFromContext returns a traceparent header value continuing the
+// trace of the request ctx belongs to, for propagation to downstream calls
+// and messages.
+func traceparentFromContext(ctx context.Context) string {
+	traceID := traceIDFromContext(ctx)
+	if traceID == "" {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", traceID, randomHex(8))
+}
+
+// setPropagationHeaders sets the trace context, request ID and tenant
+// baggage of the request ctx belongs to on an outgoing HTTP request.
+func setPropagationHeaders(ctx context.Context, req *http.Request) {
+	if tp := traceparentFromContext(ctx); tp != "" {
+		req.Header.Set("traceparent", tp)
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	if b := baggageFromContext(ctx); b != "" {
+		req.Header.Set("baggage", b)
+	}
+}
+
+// respondError writes a JSON error body carrying the request's trace and
+// request IDs.
+func respondError(c *gin.Context, status int, format string, args ...any) {
+	c.JSON(status, gin.H{
+		"error":      fmt.Sprintf(format, args...),
+		"trace_id":   traceIDFromContext(c.Request.Context()),
+		"request_id": requestIDFromContext(c.Request.Context()),
+	})
+}
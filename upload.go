@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// objectStore persists uploaded objects. UPLOAD_STORAGE selects between
+// disk (the default), s3 and memory (the default in LOCAL_MODE).
+type objectStore interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+var errObjectNotFound = errors.New("object not found")
+
+var uploadStore objectStore
+
+// uploadMaxBytes bounds the size of an upload request.
+var uploadMaxBytes = getEnvInt("UPLOAD_MAX_BYTES", 32<<20)
+
+// initUploadStore sets up the upload store. Without S3, as in LOCAL_MODE,
+// UPLOAD_STORAGE=s3 falls back to disk.
+func initUploadStore() error {
+	def := "disk"
+	if localMode() {
+		def = "memory"
+	}
+	switch kind := getEnv("UPLOAD_STORAGE", def); kind {
+	case "disk":
+		uploadStore = diskStore{dir: getEnv("UPLOAD_DIR", "uploads")}
+	case "s3":
+		if !stepAvailable("s3") {
+			slog.Warn("S3 is unavailable, storing uploads on disk")
+			uploadStore = diskStore{dir: getEnv("UPLOAD_DIR", "uploads")}
+			break
+		}
+		uploadStore = newS3Store(s3c, s3Bucket)
+	case "memory":
+		uploadStore = newMemoryStore()
+	default:
+		return fmt.Errorf("unknown UPLOAD_STORAGE %q", kind)
+	}
+	return nil
+}
+
+// diskStore stores objects as files under dir.
+type diskStore struct {
+	dir string
+}
+
+func (s diskStore) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(filepath.Join(s.dir, key))
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return n, err
+}
+
+func (s diskStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errObjectNotFound
+	}
+	return f, err
+}
+
+// memoryStore keeps objects in memory.
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: map[string][]byte{}}
+}
+
+func (s *memoryStore) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = b
+	return int64(len(b)), nil
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.objects[key]
+	if !ok {
+		return nil, errObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// uploadFunc streams every file part of a multipart request into the upload
+// store without buffering it in memory first. Requests over
+// UPLOAD_MAX_BYTES are rejected with 413.
+func uploadFunc(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(uploadMaxBytes))
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		c.String(http.StatusBadRequest, "Upload error: %v", err)
+		return
+	}
+
+	var files []gin.H
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if respondTooLarge(c, err) {
+			return
+		}
+		if err != nil {
+			c.String(http.StatusBadRequest, "Upload error: %v", err)
+			return
+		}
+		if part.FileName() == "" {
+			continue
+		}
+
+		name := filepath.Base(part.FileName())
+		start := clk.Now()
+		size, err := uploadStore.Put(c.Request.Context(), name, part)
+		latency := clk.Since(start)
+		if respondTooLarge(c, err) {
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Storage error: %v", err)
+			return
+		}
+		slog.Debug("stored upload", "name", name, "size", size, "duration", latency)
+		files = append(files, gin.H{
+			"name":       name,
+			"size":       size,
+			"storage_ms": latency.Milliseconds(),
+		})
+	}
+
+	if len(files) == 0 {
+		c.String(http.StatusBadRequest, "Upload error: no files in request")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"files": files})
+}
+
+// respondTooLarge answers 413 and returns true if err is from reading past
+// the upload size limit.
+func respondTooLarge(c *gin.Context, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	respondError(c, http.StatusRequestEntityTooLarge, "Upload over %d bytes", tooLarge.Limit)
+	return true
+}
+
+// downloadUploadFunc serves back a file previously stored with /upload.
+func downloadUploadFunc(c *gin.Context) {
+	name := filepath.Base(c.Param("name"))
+	rc, err := uploadStore.Get(c.Request.Context(), name)
+	if errors.Is(err, errObjectNotFound) {
+		c.String(http.StatusNotFound, "Upload %s not found", name)
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Storage error: %v", err)
+		return
+	}
+	defer rc.Close()
+	c.DataFromReader(http.StatusOK, -1, "application/octet-stream", rc, nil)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadFunc(t *testing.T) {
+	prevStore, prevMax := uploadStore, uploadMaxBytes
+	t.Cleanup(func() { uploadStore, uploadMaxBytes = prevStore, prevMax })
+	uploadStore, uploadMaxBytes = newMemoryStore(), 1024
+
+	r := gin.New()
+	r.POST("/upload", uploadFunc)
+	tests := []struct {
+		name       string
+		size       int
+		wantStatus int
+	}{
+		{name: "under the limit", size: 512, wantStatus: http.StatusOK},
+		{name: "over the limit", size: 2048, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			fw, err := mw.CreateFormFile("file", "f.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = fw.Write([]byte(strings.Repeat("x", tt.size)))
+			_ = mw.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
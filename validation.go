@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// validationErrors counts the requests rejected by validation, per route.
+var validationErrors = expvar.NewMap("validation_errors")
+
+// fieldError is a failed validation of a single request field.
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// report fields by their JSON names rather than their Go names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// bindJSON decodes the JSON request body into v and validates it against
+// its binding tags. Malformed bodies are answered with 400, bodies failing
+// validation with 422 listing the failed fields. It returns false when it
+// has answered the request.
+func bindJSON(c *gin.Context, v any) bool {
+	err := c.ShouldBindJSON(v)
+	if err == nil {
+		return true
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	fields := make([]fieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, fieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: validationMessage(fe),
+		})
+	}
+	validationErrors.Add(c.FullPath(), 1)
+	slog.Info("validation failed",
+		"trace_id", traceIDFromContext(c.Request.Context()),
+		"route", c.FullPath(),
+		"fields", fields,
+	)
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":    "validation failed",
+		"fields":   fields,
+		"trace_id": traceIDFromContext(c.Request.Context()),
+	})
+	return false
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be an email address"
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "gt", "gte", "lt", "lte", "min", "max":
+		ops := map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<=", "min": ">=", "max": "<="}
+		if fe.Kind() == reflect.String || fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map {
+			return fmt.Sprintf("length must be %s %s", ops[fe.Tag()], fe.Param())
+		}
+		return fmt.Sprintf("must be %s %s", ops[fe.Tag()], fe.Param())
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
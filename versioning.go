@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The domain API is served in two versions. v2 wraps every successful
+// response in a {"data": ...} envelope; v1 returns resources bare and lists
+// under a named key. v1 is deprecated: its responses carry Deprecation,
+// Sunset and successor Link headers. The unversioned paths are served as
+// v1 for existing clients.
+
+const apiVersionKey = "api_version"
+
+// apiV1Sunset is when v1 is to be retired, as an HTTP date.
+var apiV1Sunset = getEnv("API_V1_SUNSET", "Wed, 30 Jun 2027 00:00:00 GMT")
+
+// apiVersionMiddleware marks the requests of a route group as being for
+// API version v.
+func apiVersionMiddleware(v int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, v)
+		c.Header("API-Version", "v"+strconv.Itoa(v))
+		if v == 1 {
+			c.Header("Deprecation", "true")
+			c.Header("Sunset", apiV1Sunset)
+			successor := "/v2" + strings.TrimPrefix(c.Request.URL.Path, "/v1")
+			c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		c.Next()
+	}
+}
+
+// registerDomainRoutes registers the users, orders and events API on g.
+func registerDomainRoutes(g routeGroup) {
+	g.POST("/users", createUserFunc(userRepo))
+	g.GET("/users", listUsersFunc(userRepo))
+	g.GET("/users/:id", getUserFunc(userRepo))
+	g.GET("/users/:id/orders", listUserOrdersFunc)
+	g.POST("/orders", createOrderFunc)
+	g.GET("/orders/:id", getOrderFunc)
+	g.POST("/events", createEventFunc)
+	g.GET("/events/stats", eventStatsFunc)
+}
+
+// respond writes v in the shape of the request's API version: bare, or
+// under key if set, for v1; in a data envelope for v2.
+func respond(c *gin.Context, status int, key string, v any) {
+	switch {
+	case c.GetInt(apiVersionKey) >= 2:
+		c.JSON(status, gin.H{"data": v})
+	case key != "":
+		c.JSON(status, gin.H{key: v})
+	default:
+		c.JSON(status, v)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ready flips to true once warmUp has completed.
+	ready atomic.Bool
+
+	// mysqlNowStmt is prepared during warm-up; handlers fall back to an
+	// unprepared query until it is set.
+	mysqlNowStmt atomic.Pointer[sql.Stmt]
+)
+
+// warmUp primes connection pools, prepared statements and hot cache keys and
+// then calls a few of the app's own endpoints, so that the first real
+// requests don't pay for cold connections. Failures are logged but don't
+// prevent the app from becoming ready.
+func warmUp(ctx context.Context, baseURL string) {
+	start := clk.Now()
+	ctx, cancel := context.WithTimeout(ctx, getEnvDuration("WARMUP_TIMEOUT", 30*time.Second))
+	defer cancel()
+
+	if stepAvailable("mysql") {
+		warmUpMySQL(ctx)
+	}
+
+	// prime hot cache keys
+	if stepAvailable("cache") {
+		if _, err := appCache.Get(ctx, "key"); err != nil && !errors.Is(err, errCacheMiss) {
+			slog.Warn("warm-up: redis failed", "error", err)
+		}
+	}
+
+	// exercise the app's own endpoints
+	for _, path := range []string{"/", "/mysql", "/redis", "/mongo", "/clickhouse"} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+		resp, err := hcl.Do(req)
+		if err != nil {
+			slog.Warn("warm-up: self-request failed", "path", path, "error", err)
+			continue
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	ready.Store(true)
+	setGRPCServing(true)
+	recordEvent(context.Background(), "ready", "warm-up completed in %s", clk.Since(start))
+}
+
+// warmUpMySQL opens MySQL connections up to WARMUP_MYSQL_CONNS and prepares
+// the hot statements.
+func warmUpMySQL(ctx context.Context) {
+	// open connections up to the idle pool size
+	conns := getEnvInt("WARMUP_MYSQL_CONNS", 5)
+	mysqldb.SetMaxIdleConns(conns)
+	var wg sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := mysqldb.Conn(ctx)
+			if err != nil {
+				slog.Warn("warm-up: mysql connection failed", "error", err)
+				return
+			}
+			_ = conn.PingContext(ctx)
+			_ = conn.Close()
+		}()
+	}
+	wg.Wait()
+
+	// prime prepared statements
+	if stmt, err := mysqldb.PrepareContext(ctx, "SELECT NOW()"); err != nil {
+		slog.Warn("warm-up: mysql prepare failed", "error", err)
+	} else {
+		mysqlNowStmt.Store(stmt)
+	}
+}
+
+func readyzFunc(c *gin.Context) {
+	if !ready.Load() {
+		respondError(c, http.StatusServiceUnavailable, "warming up")
+		return
+	}
+	c.String(http.StatusOK, "ready")
+}
@@ -0,0 +1,47 @@
+// Calls the API with a W3C traceparent generated here, the way browser RUM
+// agents do, and shows whether the API continued the browser's trace.
+
+function randomHex(bytes) {
+  const buf = new Uint8Array(bytes);
+  crypto.getRandomValues(buf);
+  return Array.from(buf, (b) => b.toString(16).padStart(2, "0")).join("");
+}
+
+async function call(method, path, body) {
+  const traceId = randomHex(16);
+  const headers = { traceparent: `00-${traceId}-${randomHex(8)}-01` };
+  if (body) {
+    headers["Content-Type"] = "application/json";
+  }
+  const start = performance.now();
+  let status, returnedTraceId;
+  try {
+    const resp = await fetch(path, { method, headers, body });
+    status = resp.status;
+    returnedTraceId = resp.headers.get("X-Trace-Id");
+  } catch (err) {
+    status = err.message;
+  }
+  const row = document.createElement("tr");
+  for (const [text, cls] of [
+    [`${method} ${path}`],
+    [status],
+    [(performance.now() - start).toFixed(1)],
+    [traceId, "trace"],
+    [returnedTraceId === traceId ? "yes" : "no"],
+  ]) {
+    const td = document.createElement("td");
+    td.textContent = text;
+    if (cls) {
+      td.className = cls;
+    }
+    row.appendChild(td);
+  }
+  document.getElementById("log").prepend(row);
+}
+
+for (const button of document.querySelectorAll("#calls button")) {
+  button.addEventListener("click", () =>
+    call(button.dataset.method, button.dataset.path, button.dataset.body),
+  );
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errPoolSaturated = errors.New("worker pool saturated")
+
+// poolStats publishes the state of every worker pool by name.
+var poolStats = expvar.NewMap("pools")
+
+var (
+	// cpuPool runs CPU-bound work, one task per CPU at a time.
+	cpuPool = newWorkerPool("cpu", getEnvInt("CPU_POOL_WORKERS", runtime.GOMAXPROCS(0)), getEnvInt("CPU_POOL_QUEUE", 64))
+	// ioPool runs work waiting on the network or disk.
+	ioPool = newWorkerPool("io", getEnvInt("IO_POOL_WORKERS", 16), getEnvInt("IO_POOL_QUEUE", 256))
+)
+
+// workerPool runs tasks on a fixed number of workers. Tasks wait in a
+// bounded queue for a free worker; once the queue is full, submitters wait
+// for room in it, which is how the pool pushes back on its callers.
+type workerPool struct {
+	name    string
+	workers int
+	tasks   chan *poolTask
+
+	active    atomic.Int64
+	completed atomic.Int64
+	rejected  atomic.Int64
+	waits     *latencyHistogram
+	latencies *latencyHistogram
+}
+
+type poolTask struct {
+	ctx      context.Context
+	name     string
+	fn       func(ctx context.Context) error
+	enqueued time.Time
+	done     chan error
+}
+
+type poolSnapshot struct {
+	Workers    int     `json:"workers"`
+	Active     int64   `json:"active"`
+	QueueDepth int     `json:"queue_depth"`
+	QueueSize  int     `json:"queue_size"`
+	Completed  int64   `json:"completed"`
+	Rejected   int64   `json:"rejected"`
+	WaitP50Ms  float64 `json:"wait_p50_ms"`
+	WaitP95Ms  float64 `json:"wait_p95_ms"`
+	TaskP50Ms  float64 `json:"task_p50_ms"`
+	TaskP95Ms  float64 `json:"task_p95_ms"`
+}
+
+func newWorkerPool(name string, workers, queue int) *workerPool {
+	p := &workerPool{
+		name:      name,
+		workers:   max(workers, 1),
+		tasks:     make(chan *poolTask, max(queue, 0)),
+		waits:     newLatencyHistogram(),
+		latencies: newLatencyHistogram(),
+	}
+	for range p.workers {
+		go p.work()
+	}
+	poolStats.Set(name, expvar.Func(func() any { return p.snapshot() }))
+	return p
+}
+
+// Do runs fn on the pool and returns its error. It returns
+// errPoolSaturated if ctx is done before fn got into the queue, and
+// ctx's error if ctx is done while fn is queued or running.
+func (p *workerPool) Do(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	t := &poolTask{ctx: ctx, name: name, fn: fn, enqueued: clk.Now(), done: make(chan error, 1)}
+	select {
+	case p.tasks <- t:
+	case <-ctx.Done():
+		p.rejected.Add(1)
+		return fmt.Errorf("%w: %s", errPoolSaturated, p.name)
+	}
+	select {
+	case err := <-t.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *workerPool) work() {
+	for t := range p.tasks {
+		wait := clk.Since(t.enqueued)
+		p.waits.record(wait)
+		if t.ctx.Err() != nil {
+			// nobody is waiting for the result any more
+			t.done <- t.ctx.Err()
+			continue
+		}
+
+		p.active.Add(1)
+		start := clk.Now()
+		err := t.fn(t.ctx)
+		latency := clk.Since(start)
+		p.active.Add(-1)
+		p.completed.Add(1)
+		p.latencies.record(latency)
+		slog.Debug("pool task",
+			"trace_id", traceIDFromContext(t.ctx),
+			"pool", p.name,
+			"task", t.name,
+			"wait", wait,
+			"duration", latency,
+			"error", err,
+		)
+		t.done <- err
+	}
+}
+
+func (p *workerPool) snapshot() poolSnapshot {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return poolSnapshot{
+		Workers:    p.workers,
+		Active:     p.active.Load(),
+		QueueDepth: len(p.tasks),
+		QueueSize:  cap(p.tasks),
+		Completed:  p.completed.Load(),
+		Rejected:   p.rejected.Load(),
+		WaitP50Ms:  ms(p.waits.quantile(0.5)),
+		WaitP95Ms:  ms(p.waits.quantile(0.95)),
+		TaskP50Ms:  ms(p.latencies.quantile(0.5)),
+		TaskP95Ms:  ms(p.latencies.quantile(0.95)),
+	}
+}
+
+// doAll runs one task per i in [0, n) on the pool and returns the first
+// error.
+func (p *workerPool) doAll(ctx context.Context, name string, n int, fn func(ctx context.Context, i int) error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = p.Do(ctx, name, func(ctx context.Context) error { return fn(ctx, i) })
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondPoolError answers 503 with a Retry-After when the pool pushed
+// back, 500 otherwise.
+func respondPoolError(c *gin.Context, err error) {
+	if errors.Is(err, errPoolSaturated) {
+		c.Header("Retry-After", "1")
+		respondError(c, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	respondError(c, http.StatusInternalServerError, "Task error: %v", err)
+}
+
+// workHashFunc hashes ?tasks= blocks ?rounds= times each on the CPU pool.
+func workHashFunc(c *gin.Context) {
+	tasks, err := strconv.Atoi(c.DefaultQuery("tasks", "4"))
+	if err != nil || tasks < 1 || tasks > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tasks must be between 1 and 1000"})
+		return
+	}
+	rounds, err := strconv.Atoi(c.DefaultQuery("rounds", "100000"))
+	if err != nil || rounds < 1 || rounds > 10_000_000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rounds must be between 1 and 10000000"})
+		return
+	}
+
+	sums := make([]string, tasks)
+	err = cpuPool.doAll(c.Request.Context(), "hash", tasks, func(ctx context.Context, i int) error {
+		sum := sha256.Sum256([]byte(strconv.Itoa(i)))
+		for r := 1; r < rounds; r++ {
+			if r%10_000 == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			sum = sha256.Sum256(sum[:])
+		}
+		sums[i] = hex.EncodeToString(sum[:8])
+		return nil
+	})
+	if err != nil {
+		respondPoolError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sums": sums})
+}
+
+// workIOFunc runs ?tasks= simulated I/O calls of ?delay_ms= on the I/O pool.
+func workIOFunc(c *gin.Context) {
+	tasks, err := strconv.Atoi(c.DefaultQuery("tasks", "8"))
+	if err != nil || tasks < 1 || tasks > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tasks must be between 1 and 1000"})
+		return
+	}
+	delayMs, err := strconv.Atoi(c.DefaultQuery("delay_ms", "50"))
+	if err != nil || delayMs < 0 || delayMs > 60_000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delay_ms must be between 0 and 60000"})
+		return
+	}
+
+	start := clk.Now()
+	err = ioPool.doAll(c.Request.Context(), "io", tasks, func(ctx context.Context, _ int) error {
+		sleepCtx(ctx, time.Duration(delayMs)*time.Millisecond)
+		return ctx.Err()
+	})
+	if err != nil {
+		respondPoolError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks, "duration_ms": clk.Since(start).Milliseconds()})
+}
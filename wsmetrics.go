@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	// the demo page may be served from another origin
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// metricsSnapshot returns the in-process metrics streamed by /ws/metrics.
+func metricsSnapshot() gin.H {
+	const rateWindow = 10 * time.Second
+	recent := reqStats.since(rateWindow)
+	lastMinute := reqStats.since(time.Minute)
+
+	snap := gin.H{
+		"time":       clk.Now().UTC(),
+		"rps":        float64(len(recent)) / rateWindow.Seconds(),
+		"p95_ms":     float64(percentile(lastMinute, 95).Microseconds()) / 1000,
+		"in_flight":  reqStats.inFlight.Load(),
+		"goroutines": runtime.NumGoroutine(),
+	}
+	if mysqldb != nil {
+		st := mysqldb.Stats()
+		snap["mysql_pool"] = gin.H{
+			"open":       st.OpenConnections,
+			"in_use":     st.InUse,
+			"idle":       st.Idle,
+			"wait_count": st.WaitCount,
+		}
+	}
+	if rdb != nil {
+		st := rdb.PoolStats()
+		snap["redis_pool"] = gin.H{
+			"total":  st.TotalConns,
+			"idle":   st.IdleConns,
+			"hits":   st.Hits,
+			"misses": st.Misses,
+		}
+	}
+	if mb, ok := bus.(*memoryBus); ok {
+		snap["queue_depth"] = mb.Len()
+	}
+	return snap
+}
+
+// wsMetricsFunc streams a metrics snapshot every second until the client
+// goes away.
+func wsMetricsFunc(c *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// the read loop processes control frames and notices when the client
+	// closes the connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteJSON(metricsSnapshot()); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-closed:
+			return
+		}
+	}
+}